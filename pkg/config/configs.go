@@ -1,13 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
-	"github.com/kelseyhightower/envconfig"
-	"github.com/spf13/viper"
-	"github.com/tuanp/go-mircroservice-boilerplate/pkg/constants"
 )
 
 type LogType int32
@@ -17,44 +17,95 @@ const (
 	defaultHTTPRWTimeout          = 10 * time.Second
 	defaultHTTPMaxHeaderMegabytes = 1
 
+	defaultRetryMaxAttempts     = 5
+	defaultRetryInitialInterval = 500 * time.Millisecond
+	defaultRetryMaxInterval     = 10 * time.Second
+	defaultRetryMultiplier      = 2.0
+	defaultRetryJitter          = 0.2
+
+	// RedisStandalone, RedisSentinel and RedisCluster are the RedisConfig modes.
+	RedisStandalone = "standalone"
+	RedisSentinel   = "sentinel"
+	RedisCluster    = "cluster"
+
 	Zap    LogType = 0
 	Logrus LogType = 1
 )
 
+// Section identifies a top-level block of the configuration.
+type Section string
+
+const (
+	SectionDatabase Section = "database"
+	SectionHTTP     Section = "http"
+	SectionRedis    Section = "redis"
+	SectionLogger   Section = "logger"
+	SectionServer   Section = "server"
+	SectionCacheTTL Section = "cache.ttl"
+
+	SectionFeatureFlags Section = "featureFlags"
+	SectionOutbox       Section = "outbox"
+	SectionRateLimit    Section = "rateLimit"
+	SectionWorker       Section = "worker"
+)
+
+// Sections lists every section of Config in the order they are unmarshalled.
+var Sections = []Section{
+	SectionCacheTTL,
+	SectionDatabase,
+	SectionRedis,
+	SectionLogger,
+	SectionServer,
+	SectionHTTP,
+	SectionFeatureFlags,
+	SectionOutbox,
+	SectionRateLimit,
+	SectionWorker,
+}
+
 type (
 	Config struct {
-		Mysql    MysqlConfig
-		HTTP     HTTPConfig
-		Redis    RedisConfig
-		Logger   LoggerConfig
-		Server   ServerConfig
-		CacheTTL time.Duration `mapstructure:"ttl"`
+		Database DatabaseConfig `mapstructure:"database"`
+		HTTP     HTTPConfig     `mapstructure:"http"`
+		Redis    RedisConfig    `mapstructure:"redis"`
+		Logger   LoggerConfig   `mapstructure:"logger"`
+		Server   ServerConfig   `mapstructure:"server"`
+		CacheTTL time.Duration  `mapstructure:"cache.ttl" validate:"gte=0"`
+
+		FeatureFlags map[string]FeatureFlagConfig `mapstructure:"featureFlags" validate:"dive"`
+		Outbox       OutboxConfig                 `mapstructure:"outbox"`
+		RateLimit    RateLimitConfig              `mapstructure:"rateLimit"`
+		Worker       WorkerConfig                 `mapstructure:"worker"`
 	}
 
 	HTTPConfig struct {
 		Host               string        `mapstructure:"host"`
-		Port               string        `mapstructure:"port"`
-		ReadTimeout        time.Duration `mapstructure:"readTimeout"`
-		WriteTimeout       time.Duration `mapstructure:"writeTimeout"`
-		MaxHeaderMegabytes int           `mapstructure:"maxHeaderBytes"`
+		Port               string        `mapstructure:"port" validate:"required,numeric"`
+		ReadTimeout        time.Duration `mapstructure:"readTimeout" validate:"gte=0"`
+		WriteTimeout       time.Duration `mapstructure:"writeTimeout" validate:"gte=0"`
+		MaxHeaderMegabytes int           `mapstructure:"maxHeaderBytes" validate:"gte=0"`
+		// TrustedProxies are the CIDRs of the reverse proxies whose
+		// X-Forwarded-For header gives the client IP. When empty the
+		// client IP is the address of the connection.
+		TrustedProxies []string `mapstructure:"trustedProxies" validate:"dive,cidr"`
 	}
 
 	// MysqlConfig is settings of a MySQL server. It contains almost same fields as mysql.Config,
 	// but with some different field names and tags.
 	MysqlConfig struct {
 		Username  string            `yaml:"username" mapstructure:"username"`
-		Password  string            `yaml:"password" mapstructure:"password"`
-		Protocol  string            `yaml:"protocol" mapstructure:"protocol"`
-		Address   string            `yaml:"address" mapstructure:"address"`
-		Database  string            `yaml:"database" mapstructure:"database"`
+		Password  string            `yaml:"password" mapstructure:"password" secret:"true"`
+		Protocol  string            `yaml:"protocol" mapstructure:"protocol" validate:"omitempty,oneof=tcp unix"`
+		Address   string            `yaml:"address" mapstructure:"address" validate:"required"`
+		Database  string            `yaml:"database" mapstructure:"database" validate:"required"`
 		Params    map[string]string `yaml:"params" mapstructure:"params"`
 		Collation string            `yaml:"collation" mapstructure:"collation"`
 		Loc       *time.Location    `yaml:"location" mapstructure:"loc"`
 		TLSConfig string            `yaml:"tlsConfig" mapstructure:"tlsConfig"`
 
-		Timeout      time.Duration `yaml:"timeout" mapstructure:"timeout"`
-		ReadTimeout  time.Duration `yaml:"readTimeout" mapstructure:"readTimeout"`
-		WriteTimeout time.Duration `yaml:"writeTimeout" mapstructure:"writeTimeout"`
+		Timeout      time.Duration `yaml:"timeout" mapstructure:"timeout" validate:"gte=0"`
+		ReadTimeout  time.Duration `yaml:"readTimeout" mapstructure:"readTimeout" validate:"gte=0"`
+		WriteTimeout time.Duration `yaml:"writeTimeout" mapstructure:"writeTimeout" validate:"gte=0"`
 
 		AllowAllFiles           bool   `yaml:"allowAllFiles" mapstructure:"allowAllFiles"`
 		AllowCleartextPasswords bool   `yaml:"allowCleartextPasswords" mapstructure:"allowCleartextPasswords"`
@@ -65,33 +116,180 @@ type (
 		MultiStatements         bool   `yaml:"multiStatements" mapstructure:"multiStatements"`
 		ParseTime               bool   `yaml:"parseTime" mapstructure:"parseTime"`
 		GoogleAuthFile          string `yaml:"googleAuthFile" mapstructure:"googleAuthFile"`
+
+		// TLS enables TLS with the given files, overriding TLSConfig.
+		TLS TLSConfig `yaml:"tls" mapstructure:"tls"`
 	}
 
+	// RetryConfig is the exponential backoff used to (re)connect to a server.
+	// The n-th retry waits InitialInterval * Multiplier^(n-1), capped at
+	// MaxInterval, randomized by +/- Jitter (a fraction of the wait).
+	RetryConfig struct {
+		MaxAttempts     int           `yaml:"maxAttempts" mapstructure:"maxAttempts" validate:"gte=0"`
+		InitialInterval time.Duration `yaml:"initialInterval" mapstructure:"initialInterval" validate:"gte=0"`
+		MaxInterval     time.Duration `yaml:"maxInterval" mapstructure:"maxInterval" validate:"gte=0"`
+		Multiplier      float64       `yaml:"multiplier" mapstructure:"multiplier" validate:"omitempty,gte=1"`
+		Jitter          float64       `yaml:"jitter" mapstructure:"jitter" validate:"gte=0,lte=1"`
+	}
+
+	// RedisConfig is settings of a Redis deployment. Mode selects a single
+	// server at Addr, a Sentinel group monitoring MasterName or a Cluster
+	// discovered from the seed Addrs.
 	RedisConfig struct {
-		Addr         string `mapstructure:"addr"`
-		Password     string `mapstructure:"password"`
-		DB           int    `mapstructure:"db"`
-		PoolSize     int    `mapstructure:"poolSize"`
-		MinIdleConns int    `mapstructure:"minIdleConns"`
-		PoolTimeout  int    `mapstructure:"poolTimeout"`
+		Mode       string   `yaml:"mode" mapstructure:"mode" validate:"omitempty,oneof=standalone sentinel cluster"`
+		Addr       string   `yaml:"addr" mapstructure:"addr" validate:"required_without=Addrs"`
+		Addrs      []string `yaml:"addrs" mapstructure:"addrs" validate:"required_if=Mode sentinel,required_if=Mode cluster"`
+		MasterName string   `yaml:"masterName" mapstructure:"masterName" validate:"required_if=Mode sentinel"`
+
+		// Username and Password authenticate to the servers, Username with
+		// Redis 6 ACLs. The Sentinel ones authenticate to the sentinels.
+		Username         string `yaml:"username" mapstructure:"username"`
+		Password         string `yaml:"password" mapstructure:"password" secret:"true"`
+		SentinelUsername string `yaml:"sentinelUsername" mapstructure:"sentinelUsername"`
+		SentinelPassword string `yaml:"sentinelPassword" mapstructure:"sentinelPassword" secret:"true"`
+		DB               int    `yaml:"db" mapstructure:"db" validate:"gte=0"`
+
+		DialTimeout  time.Duration `yaml:"dialTimeout" mapstructure:"dialTimeout" validate:"gte=0"`
+		ReadTimeout  time.Duration `yaml:"readTimeout" mapstructure:"readTimeout" validate:"gte=0"`
+		WriteTimeout time.Duration `yaml:"writeTimeout" mapstructure:"writeTimeout" validate:"gte=0"`
+
+		PoolSize     int           `yaml:"poolSize" mapstructure:"poolSize" validate:"gte=0"`
+		MinIdleConns int           `yaml:"minIdleConns" mapstructure:"minIdleConns" validate:"gte=0"`
+		PoolTimeout  time.Duration `yaml:"poolTimeout" mapstructure:"poolTimeout" validate:"gte=0"`
+
+		TLS   TLSConfig   `yaml:"tls" mapstructure:"tls"`
+		Retry RetryConfig `yaml:"retry" mapstructure:"retry"`
+	}
+
+	// TLSConfig enables TLS to a server. CAFile verifies the server with
+	// a custom CA instead of the system pool; CertFile and KeyFile hold
+	// the client certificate for mutual TLS.
+	TLSConfig struct {
+		Enabled            bool   `yaml:"enabled" mapstructure:"enabled"`
+		CAFile             string `yaml:"caFile" mapstructure:"caFile"`
+		CertFile           string `yaml:"certFile" mapstructure:"certFile" validate:"required_with=KeyFile"`
+		KeyFile            string `yaml:"keyFile" mapstructure:"keyFile" validate:"required_with=CertFile"`
+		ServerName         string `yaml:"serverName" mapstructure:"serverName"`
+		InsecureSkipVerify bool   `yaml:"insecureSkipVerify" mapstructure:"insecureSkipVerify"`
 	}
 
 	LoggerConfig struct {
 		Development       bool    `yaml:"development" mapstructure:"development"`
 		DisableCaller     bool    `yaml:"disableCaller" mapstructure:"disableCaller"`
 		DisableStacktrace bool    `yaml:"disableStacktrace" mapstructure:"disableStacktrace"`
-		Encoding          string  `yaml:"encoding" mapstructure:"encoding"`
-		LogLevel          string  `yaml:"level" mapstructure:"level"`
-		LogType           LogType `yaml:"logType" mapstructure:"logType"`
+		Encoding          string  `yaml:"encoding" mapstructure:"encoding" validate:"omitempty,oneof=json console"`
+		LogLevel          string  `yaml:"level" mapstructure:"level" validate:"required,oneof=debug info warn error panic fatal"`
+		LogType           LogType `yaml:"logType" mapstructure:"logType" validate:"logtype"`
+	}
+
+	// FeatureFlagConfig defines a feature flag. An enabled flag is on for
+	// the listed users and tenants, and for Percentage percent of the
+	// others: 0 turns it on for no one else, 100 for everyone. Flag names
+	// are case-insensitive.
+	FeatureFlagConfig struct {
+		Enabled    bool     `yaml:"enabled" mapstructure:"enabled"`
+		Percentage int      `yaml:"percentage" mapstructure:"percentage" validate:"gte=0,lte=100"`
+		Users      []string `yaml:"users" mapstructure:"users"`
+		Tenants    []string `yaml:"tenants" mapstructure:"tenants"`
 	}
 
 	ServerConfig struct {
 		AppVersion string `yaml:"appVersion" mapstructure:"appVersion"`
-		Mode       string `yaml:"mode" mapstructure:"mode"`
+		Mode       string `yaml:"mode" mapstructure:"mode" validate:"required,oneof=dev test prod"`
 		Debug      bool   `yaml:"debug" mapstructure:"debug"`
 	}
 )
 
+var logTypeNames = map[LogType]string{
+	Zap:    "zap",
+	Logrus: "logrus",
+}
+
+// ParseLogType returns the LogType named s, e.g. "zap".
+func ParseLogType(s string) (LogType, error) {
+	for t, name := range logTypeNames {
+		if strings.EqualFold(s, name) {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log type %q", s)
+}
+
+func (t LogType) String() string {
+	if name, ok := logTypeNames[t]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(t))
+}
+
+func (t LogType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *LogType) UnmarshalText(text []byte) error {
+	parsed, err := ParseLogType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+
+	return nil
+}
+
+// Values lists the names of the known log types.
+func (LogType) Values() []interface{} {
+	return []interface{}{Zap.String(), Logrus.String()}
+}
+
+// WithDefaults returns r with the zero fields set to the loader defaults,
+// for configs built without a Loader.
+func (r RetryConfig) WithDefaults() RetryConfig {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if r.InitialInterval == 0 {
+		r.InitialInterval = defaultRetryInitialInterval
+	}
+	if r.MaxInterval == 0 {
+		r.MaxInterval = defaultRetryMaxInterval
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = defaultRetryMultiplier
+	}
+
+	return r
+}
+
+// Section returns a pointer to the part of cfg identified by s,
+// or nil if s is unknown.
+func (cfg *Config) Section(s Section) interface{} {
+	switch s {
+	case SectionDatabase:
+		return &cfg.Database
+	case SectionHTTP:
+		return &cfg.HTTP
+	case SectionRedis:
+		return &cfg.Redis
+	case SectionLogger:
+		return &cfg.Logger
+	case SectionServer:
+		return &cfg.Server
+	case SectionCacheTTL:
+		return &cfg.CacheTTL
+	case SectionFeatureFlags:
+		return &cfg.FeatureFlags
+	case SectionOutbox:
+		return &cfg.Outbox
+	case SectionRateLimit:
+		return &cfg.RateLimit
+	case SectionWorker:
+		return &cfg.Worker
+	}
+	return nil
+}
+
 // FormatDSN returns MySQL DSN from settings.
 func (m *MysqlConfig) FormatDSN() string {
 	um := &mysql.Config{
@@ -122,87 +320,10 @@ func (m *MysqlConfig) FormatDSN() string {
 
 // Init populates Config struct with values from config file
 // located at filepath and environment variables.
+// It fails with ValidationErrors if the resulting config is invalid.
 func Init(configsDir string) (*Config, error) {
-	populateDefaults()
-
-	if err := parseConfigFile(configsDir, os.Getenv("APP_ENV")); err != nil {
-		return nil, err
-	}
-
-	var cfg Config
-	if err := unmarshal(&cfg); err != nil {
-		return nil, err
-	}
-
-	// Override configuration from environment settings
-	if err := setFromEnv(&cfg); err != nil {
-		return nil, err
-	}
-
-	return &cfg, nil
-}
-
-func unmarshal(cfg *Config) error {
-	if err := viper.UnmarshalKey("cache.ttl", &cfg.CacheTTL); err != nil {
-		return err
-	}
-
-	if err := viper.UnmarshalKey("mysql", &cfg.Mysql); err != nil {
-		return err
-	}
-
-	if err := viper.UnmarshalKey("redis", &cfg.Redis); err != nil {
-		return err
-	}
-
-	if err := viper.UnmarshalKey("logger", &cfg.Logger); err != nil {
-		return err
-	}
-
-	if err := viper.UnmarshalKey("server", &cfg.Server); err != nil {
-		return err
-	}
-
-	return viper.UnmarshalKey("http", &cfg.HTTP)
-}
-
-func setFromEnv(cfg *Config) error {
-
-	if err := envconfig.Process("mysql", &cfg.Mysql); err != nil {
-		return err
-	}
-
-	if err := envconfig.Process("redis", &cfg.Redis); err != nil {
-		return err
-	}
-
-	if err := envconfig.Process("http", &cfg.HTTP); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func parseConfigFile(folder, env string) error {
-	viper.AddConfigPath(folder)
-	viper.SetConfigName("base")
-
-	if err := viper.ReadInConfig(); err != nil {
-		return err
-	}
-
-	if env == constants.EnvDev {
-		return nil
-	}
-
-	viper.SetConfigName(env)
-
-	return viper.MergeInConfig()
-}
-
-func populateDefaults() {
-	viper.SetDefault("http.port", defaultHTTPPort)
-	viper.SetDefault("http.max_header_megabytes", defaultHTTPMaxHeaderMegabytes)
-	viper.SetDefault("http.timeouts.read", defaultHTTPRWTimeout)
-	viper.SetDefault("http.timeouts.write", defaultHTTPRWTimeout)
+	return NewLoader(LoaderOptions{
+		ConfigDir:   configsDir,
+		Environment: os.Getenv("APP_ENV"),
+	}).Load()
 }
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DriverMySQL, DriverPostgres and DriverSQLite are the database drivers.
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+
+	// ReadRandom and ReadRoundRobin are the policies balancing reads across replicas.
+	ReadRandom     = "random"
+	ReadRoundRobin = "roundRobin"
+
+	// SQLiteMemory is the SQLiteConfig path of an in-memory database.
+	SQLiteMemory = ":memory:"
+
+	defaultPostgresPort = "5432"
+
+	defaultPoolMaxOpenConns    = 100
+	defaultPoolMaxIdleConns    = 10
+	defaultPoolConnMaxLifetime = 30 * time.Minute
+
+	defaultReadYourWritesWindow = 2 * time.Second
+
+	// SQLLogSilent, SQLLogError, SQLLogWarn and SQLLogInfo are the SQL
+	// log levels: nothing, failed queries, failed and slow queries, and
+	// every query.
+	SQLLogSilent = "silent"
+	SQLLogError  = "error"
+	SQLLogWarn   = "warn"
+	SQLLogInfo   = "info"
+
+	defaultSQLLogSlowThreshold = 200 * time.Millisecond
+)
+
+type (
+	// DatabaseConfig selects the SQL database of a service. Only the
+	// block of Driver is used, the others may be left out.
+	DatabaseConfig struct {
+		Driver   string          `yaml:"driver" mapstructure:"driver" validate:"required,oneof=mysql postgres sqlite"`
+		MySQL    *MysqlConfig    `yaml:"mysql" mapstructure:"mysql" validate:"required_if=Driver mysql"`
+		Postgres *PostgresConfig `yaml:"postgres" mapstructure:"postgres" validate:"required_if=Driver postgres"`
+		SQLite   *SQLiteConfig   `yaml:"sqlite" mapstructure:"sqlite" validate:"required_if=Driver sqlite"`
+
+		Pool  PoolConfig   `yaml:"pool" mapstructure:"pool"`
+		Retry RetryConfig  `yaml:"retry" mapstructure:"retry"`
+		Log   SQLLogConfig `yaml:"log" mapstructure:"log"`
+
+		// Replicas serve the reads outside transactions, picked by
+		// ReadPolicy. Reads of a context marked by a write stay on the
+		// primary for ReadYourWritesWindow, see db.WithReadYourWrites.
+		Replicas             []ReplicaConfig `yaml:"replicas" mapstructure:"replicas" validate:"dive"`
+		ReadPolicy           string          `yaml:"readPolicy" mapstructure:"readPolicy" validate:"omitempty,oneof=random roundRobin"`
+		ReadYourWritesWindow time.Duration   `yaml:"readYourWritesWindow" mapstructure:"readYourWritesWindow" validate:"gte=0"`
+	}
+
+	// PostgresConfig is settings of a PostgreSQL server. The SSL fields
+	// are those of libpq, e.g. SSLMode "verify-full" with SSLRootCert.
+	PostgresConfig struct {
+		Address        string            `yaml:"address" mapstructure:"address" validate:"required"`
+		Database       string            `yaml:"database" mapstructure:"database" validate:"required"`
+		Username       string            `yaml:"username" mapstructure:"username"`
+		Password       string            `yaml:"password" mapstructure:"password" secret:"true"`
+		SearchPath     string            `yaml:"searchPath" mapstructure:"searchPath"`
+		ConnectTimeout time.Duration     `yaml:"connectTimeout" mapstructure:"connectTimeout" validate:"gte=0"`
+		Params         map[string]string `yaml:"params" mapstructure:"params"`
+
+		SSLMode     string `yaml:"sslMode" mapstructure:"sslMode" validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"`
+		SSLRootCert string `yaml:"sslRootCert" mapstructure:"sslRootCert"`
+		SSLCert     string `yaml:"sslCert" mapstructure:"sslCert" validate:"required_with=SSLKey"`
+		SSLKey      string `yaml:"sslKey" mapstructure:"sslKey" validate:"required_with=SSLCert"`
+	}
+
+	// SQLiteConfig is settings of a SQLite database file, or of an
+	// in-memory database with SQLiteMemory. Params are the driver
+	// options, e.g. "_foreign_keys: 1" or "_journal_mode: WAL".
+	SQLiteConfig struct {
+		Path   string            `yaml:"path" mapstructure:"path" validate:"required"`
+		Params map[string]string `yaml:"params" mapstructure:"params"`
+	}
+
+	// ReplicaConfig is a read replica of a database. The other settings,
+	// and the credentials when left empty, are those of the primary.
+	ReplicaConfig struct {
+		Address  string `yaml:"address" mapstructure:"address" validate:"required"`
+		Username string `yaml:"username" mapstructure:"username"`
+		Password string `yaml:"password" mapstructure:"password" secret:"true"`
+	}
+
+	// PoolConfig sizes a database/sql connection pool. Zero sizes and
+	// ConnMaxLifetime fall back to the loader defaults; a zero
+	// ConnMaxIdleTime keeps idle connections open until ConnMaxLifetime.
+	PoolConfig struct {
+		MaxOpenConns    int           `yaml:"maxOpenConns" mapstructure:"maxOpenConns" validate:"gte=0"`
+		MaxIdleConns    int           `yaml:"maxIdleConns" mapstructure:"maxIdleConns" validate:"gte=0"`
+		ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" mapstructure:"connMaxLifetime" validate:"gte=0"`
+		ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" mapstructure:"connMaxIdleTime" validate:"gte=0"`
+	}
+
+	// SQLLogConfig sets which SQL queries are logged. Queries slower than
+	// SlowThreshold are logged as slow, none when it is zero. Query
+	// parameters may hold personal data or secrets: they are left out of
+	// the logged SQL unless Params is set.
+	SQLLogConfig struct {
+		Level         string        `yaml:"level" mapstructure:"level" validate:"omitempty,oneof=silent error warn info"`
+		SlowThreshold time.Duration `yaml:"slowThreshold" mapstructure:"slowThreshold" validate:"gte=0"`
+		Params        bool          `yaml:"params" mapstructure:"params"`
+	}
+)
+
+// Replica returns the settings of the primary d pointing at replica r.
+func (d *DatabaseConfig) Replica(r ReplicaConfig) (*DatabaseConfig, error) {
+	replica := *d
+	replica.Replicas = nil
+
+	switch d.Driver {
+	case DriverMySQL:
+		if d.MySQL == nil {
+			return nil, errors.New("database.mysql is not set")
+		}
+		m := *d.MySQL
+		m.Address = r.Address
+		if r.Username != "" {
+			m.Username, m.Password = r.Username, r.Password
+		}
+		replica.MySQL = &m
+	case DriverPostgres:
+		if d.Postgres == nil {
+			return nil, errors.New("database.postgres is not set")
+		}
+		p := *d.Postgres
+		p.Address = r.Address
+		if r.Username != "" {
+			p.Username, p.Password = r.Username, r.Password
+		}
+		replica.Postgres = &p
+	default:
+		return nil, fmt.Errorf("%s does not support replicas", d.Driver)
+	}
+
+	return &replica, nil
+}
+
+// WithDefaults returns p with the zero fields set to the loader defaults,
+// for configs built without a Loader.
+func (p PoolConfig) WithDefaults() PoolConfig {
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = defaultPoolMaxOpenConns
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = defaultPoolMaxIdleConns
+	}
+	if p.ConnMaxLifetime == 0 {
+		p.ConnMaxLifetime = defaultPoolConnMaxLifetime
+	}
+
+	return p
+}
+
+// WithDefaults returns l with an empty Level set to the loader default.
+// A zero SlowThreshold is kept, as it turns slow query logging off.
+func (l SQLLogConfig) WithDefaults() SQLLogConfig {
+	if l.Level == "" {
+		l.Level = SQLLogWarn
+	}
+
+	return l
+}
+
+// FormatDSN returns PostgreSQL connection URL from settings.
+func (p *PostgresConfig) FormatDSN() string {
+	host, port, err := net.SplitHostPort(p.Address)
+	if err != nil {
+		host, port = p.Address, defaultPostgresPort
+	}
+
+	query := url.Values{}
+	for key, value := range p.Params {
+		query.Set(key, value)
+	}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("sslmode", p.SSLMode)
+	set("sslrootcert", p.SSLRootCert)
+	set("sslcert", p.SSLCert)
+	set("sslkey", p.SSLKey)
+	set("search_path", p.SearchPath)
+	if p.ConnectTimeout > 0 {
+		// libpq takes whole seconds: round up, so a sub-second timeout
+		// does not become 0, which waits forever.
+		query.Set("connect_timeout", strconv.Itoa(int(math.Ceil(p.ConnectTimeout.Seconds()))))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		Host:     net.JoinHostPort(host, port),
+		Path:     "/" + p.Database,
+		RawQuery: query.Encode(),
+	}
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+
+	return u.String()
+}
+
+// FormatDSN returns SQLite DSN from settings.
+func (s *SQLiteConfig) FormatDSN() string {
+	if len(s.Params) == 0 {
+		return s.Path
+	}
+
+	query := url.Values{}
+	for key, value := range s.Params {
+		query.Set(key, value)
+	}
+	sep := "?"
+	if strings.Contains(s.Path, "?") {
+		sep = "&"
+	}
+
+	return s.Path + sep + query.Encode()
+}
+
+// InMemory reports whether s is an in-memory database.
+func (s *SQLiteConfig) InMemory() bool {
+	return strings.Contains(s.Path, SQLiteMemory) || strings.Contains(s.Path, "mode=memory")
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPostgresConnectTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    string
+	}{
+		{timeout: 0, want: ""},
+		{timeout: 500 * time.Millisecond, want: "1"},
+		{timeout: time.Second, want: "1"},
+		{timeout: 1500 * time.Millisecond, want: "2"},
+		{timeout: 10 * time.Second, want: "10"},
+	}
+	for _, tt := range tests {
+		p := PostgresConfig{Address: "localhost:5432", Database: "db", ConnectTimeout: tt.timeout}
+		u, err := url.Parse(p.FormatDSN())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Query().Get("connect_timeout"); got != tt.want {
+			t.Errorf("connect_timeout for %s = %q, want %q", tt.timeout, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// legacyForm upgrades a deprecated form of a value. It returns the
+// upgraded value and true when value used the deprecated form.
+type legacyForm func(value interface{}) (interface{}, bool)
+
+// legacyForms lists the keys whose old form is still accepted with a warning.
+var legacyForms = map[string]struct {
+	upgrade legacyForm
+	hint    string
+}{
+	"redis.poolTimeout": {numberAs(time.Second), `use a duration such as "4s"`},
+	"logger.logType":    {numberAsLogType, `use a name such as "zap"`},
+}
+
+// movedKeys maps the deprecated keys of blocks still accepted with a
+// warning to their new key.
+var movedKeys = map[string]string{
+	"mysql": "database.mysql",
+}
+
+// moveLegacyKeys moves the deprecated keys of settings, the values of a
+// single layer, to their new key and returns a warning for each of them.
+// Moving every layer on its own keeps the layer order: a later file
+// setting a deprecated key still overrides an earlier one using the new key.
+func moveLegacyKeys(settings map[string]interface{}) []string {
+	var warnings []string
+	for _, from := range sortedKeys(movedKeys) {
+		to := movedKeys[from]
+		value := lookup(settings, from)
+		if value == nil {
+			continue
+		}
+		unset(settings, from)
+		// Keys the layer also sets in the new place win over the deprecated ones.
+		if current, ok := lookup(settings, to).(map[string]interface{}); ok {
+			if legacy, ok := value.(map[string]interface{}); ok {
+				value = merge(legacy, current)
+			}
+		}
+		set(settings, to, value)
+		warnings = append(warnings, fmt.Sprintf("%s is deprecated, use %s", from, to))
+	}
+
+	return warnings
+}
+
+// upgradeLegacy rewrites deprecated values in settings and returns a
+// warning for each of them.
+func upgradeLegacy(settings map[string]interface{}) []string {
+	var warnings []string
+	keys := make([]string, 0, len(legacyForms))
+	for key := range legacyForms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		form := legacyForms[key]
+		value := lookup(settings, key)
+		if value == nil {
+			continue
+		}
+		upgraded, ok := form.upgrade(value)
+		if !ok {
+			continue
+		}
+		set(settings, key, upgraded)
+		warnings = append(warnings, fmt.Sprintf("%s: numeric value %v is deprecated, %s", key, value, form.hint))
+	}
+
+	return warnings
+}
+
+// numberAs upgrades plain numbers, or numeric strings from the
+// environment, to a duration in unit.
+func numberAs(unit time.Duration) legacyForm {
+	return func(value interface{}) (interface{}, bool) {
+		n, ok := toNumber(value)
+		if !ok {
+			return value, false
+		}
+
+		return time.Duration(n * float64(unit)), true
+	}
+}
+
+func numberAsLogType(value interface{}) (interface{}, bool) {
+	n, ok := toNumber(value)
+	if !ok {
+		return value, false
+	}
+
+	return LogType(n).String(), true
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+
+	return 0, false
+}
+
+func decode(input, output interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           output,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			stringToLocationHookFunc(),
+			mapstructure.TextUnmarshallerHookFunc(),
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(input)
+}
+
+// stringToLocationHookFunc decodes IANA zone names such as
+// "Asia/Ho_Chi_Minh", "UTC" or "Local" into a *time.Location.
+func stringToLocationHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || (t != locationType && t != reflect.PtrTo(locationType)) {
+			return data, nil
+		}
+
+		loc, err := time.LoadLocation(data.(string))
+		if err != nil {
+			return nil, err
+		}
+		// The decoder copies the Location; make sure a lazily
+		// initialized one such as time.Local is loaded first.
+		_ = loc.String()
+
+		return loc, nil
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// merge returns dst with the keys of src set over it, recursively.
+func merge(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		if nested, ok := value.(map[string]interface{}); ok {
+			if current, ok := dst[key].(map[string]interface{}); ok {
+				dst[key] = merge(current, nested)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+
+	return dst
+}
+
+// unset removes the dotted key from settings.
+func unset(settings map[string]interface{}, key string) {
+	parts := splitKey(key)
+	m := settings
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, parts[len(parts)-1])
+}
+
+// legacyKey returns the deprecated key key was moved from, see movedKeys.
+func legacyKey(key string) (string, bool) {
+	for from, to := range movedKeys {
+		if rest := strings.TrimPrefix(key, to+"."); rest != key {
+			return from + "." + rest, true
+		}
+	}
+
+	return "", false
+}
+
+// set stores value in settings along the dotted key, creating maps as needed.
+func set(settings map[string]interface{}, key string, value interface{}) {
+	parts := splitKey(key)
+	m := settings
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[part] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
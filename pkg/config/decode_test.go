@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type decoded struct {
+	Loc     *time.Location `mapstructure:"loc"`
+	Timeout time.Duration  `mapstructure:"timeout"`
+	LogType LogType        `mapstructure:"logType"`
+	Addrs   []string       `mapstructure:"addrs"`
+}
+
+func TestDecodeHooks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  decoded
+		// loc is the name of the decoded location.
+		loc string
+	}{
+		{name: "zone name", input: map[string]interface{}{"loc": "Asia/Ho_Chi_Minh"}, loc: "Asia/Ho_Chi_Minh"},
+		{name: "UTC", input: map[string]interface{}{"loc": "UTC"}, loc: "UTC"},
+		{name: "duration", input: map[string]interface{}{"timeout": "1m30s"}, want: decoded{Timeout: 90 * time.Second}},
+		{name: "log type name", input: map[string]interface{}{"logType": "Logrus"}, want: decoded{LogType: Logrus}},
+		{name: "comma separated list", input: map[string]interface{}{"addrs": "a:1,b:2"}, want: decoded{Addrs: []string{"a:1", "b:2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got decoded
+			if err := decode(tt.input, &got); err != nil {
+				t.Fatal(err)
+			}
+			if tt.loc != "" {
+				if got.Loc == nil || got.Loc.String() != tt.loc {
+					t.Errorf("location %v, want %s", got.Loc, tt.loc)
+				}
+				got.Loc = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeHookErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+	}{
+		{name: "unknown zone", input: map[string]interface{}{"loc": "Mars/Olympus_Mons"}},
+		{name: "bad duration", input: map[string]interface{}{"timeout": "soon"}},
+		{name: "unknown log type", input: map[string]interface{}{"logType": "glog"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got decoded
+			if err := decode(tt.input, &got); err == nil {
+				t.Errorf("decoded %+v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestLoadLegacyForms(t *testing.T) {
+	tests := []struct {
+		name        string
+		redis       string
+		logType     string
+		env         map[string]string
+		poolTimeout time.Duration
+		want        LogType
+		warnings    []string
+	}{
+		{
+			name:        "current forms",
+			redis:       "poolTimeout: 4s",
+			logType:     "logrus",
+			poolTimeout: 4 * time.Second,
+			want:        Logrus,
+		},
+		{
+			name:        "numeric forms",
+			redis:       "poolTimeout: 4",
+			logType:     "1",
+			poolTimeout: 4 * time.Second,
+			want:        Logrus,
+			warnings: []string{
+				`logger.logType: numeric value 1 is deprecated, use a name such as "zap"`,
+				`redis.poolTimeout: numeric value 4 is deprecated, use a duration such as "4s"`,
+			},
+		},
+		{
+			name:        "numeric variable",
+			redis:       "poolTimeout: 4s",
+			logType:     "zap",
+			env:         map[string]string{"TEST_REDIS_POOLTIMEOUT": "1.5"},
+			poolTimeout: 1500 * time.Millisecond,
+			want:        Zap,
+			warnings:    []string{`redis.poolTimeout: numeric value 1.5 is deprecated, use a duration such as "4s"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			dir := t.TempDir()
+			writeConfig(t, dir, "base.yml", fmt.Sprintf(`server:
+  mode: dev
+logger:
+  level: info
+  logType: %s
+database:
+  driver: sqlite
+  sqlite:
+    path: ":memory:"
+redis:
+  addr: localhost:6379
+  %s
+`, tt.logType, tt.redis))
+
+			l := NewLoader(LoaderOptions{ConfigDir: dir, EnvPrefix: "TEST"})
+			cfg, err := l.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Redis.PoolTimeout != tt.poolTimeout || cfg.Logger.LogType != tt.want {
+				t.Errorf("poolTimeout %s and logType %s, want %s and %s", cfg.Redis.PoolTimeout, cfg.Logger.LogType, tt.poolTimeout, tt.want)
+			}
+			if !reflect.DeepEqual(l.Warnings(), tt.warnings) {
+				t.Errorf("warnings = %q, want %q", l.Warnings(), tt.warnings)
+			}
+		})
+	}
+}
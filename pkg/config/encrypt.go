@@ -0,0 +1,184 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	encPrefix = "ENC[AES256_GCM,"
+	encSuffix = "]"
+
+	// KeySize is the length in bytes of config encryption keys.
+	KeySize = 32
+
+	// KeyKey and KeyFileKey are the pseudo keys whose EnvName holds the
+	// encryption key, or the path of a file holding it, e.g. APP1_CONFIG_KEY.
+	KeyKey     = "config.key"
+	KeyFileKey = "config.keyFile"
+)
+
+var (
+	// ErrNoKey is returned when an encrypted value is found but no key is configured.
+	ErrNoKey = errors.New("config: encrypted value found but no encryption key is configured")
+
+	encryptedValue = regexp.MustCompile(`ENC\[AES256_GCM,[A-Za-z0-9+/=]+\]`)
+)
+
+// IsEncrypted reports whether value has the ENC[AES256_GCM,...] form.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encPrefix) && strings.HasSuffix(value, encSuffix)
+}
+
+// GenerateKey returns a new random encryption key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EncodeKey returns key in the base64 form ParseKey accepts.
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParseKey decodes a base64 encoded encryption key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid encryption key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("config: encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// ReadKeyFile reads a base64 encoded encryption key from path.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(string(data))
+}
+
+// KeyFromEnv reads the encryption key from the EnvName of KeyKey, or
+// from the file named by the EnvName of KeyFileKey. It returns ErrNoKey
+// if neither is set.
+func KeyFromEnv(prefix string) ([]byte, error) {
+	if s, ok := lookupEnv(EnvName(prefix, KeyKey)); ok {
+		return ParseKey(s)
+	}
+	if path, ok := lookupEnv(EnvName(prefix, KeyFileKey)); ok {
+		return ReadKeyFile(path)
+	}
+
+	return nil, ErrNoKey
+}
+
+// Encrypt seals plaintext with AES-256-GCM into an ENC[AES256_GCM,...] value.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed) + encSuffix, nil
+}
+
+// Decrypt opens an ENC[AES256_GCM,...] value produced by Encrypt.
+func Decrypt(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("config: value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, encPrefix), encSuffix))
+	if err != nil {
+		return "", fmt.Errorf("config: malformed encrypted value: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("config: malformed encrypted value")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("config: cannot decrypt value, wrong key?")
+	}
+
+	return string(plaintext), nil
+}
+
+// RotateKey re-encrypts every encrypted value in the file at path from
+// oldKey to newKey, keeping the rest of the file as is. It returns the
+// number of values rotated.
+func RotateKey(path string, oldKey, newKey []byte) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var rotateErr error
+	rotated := encryptedValue.ReplaceAllStringFunc(string(data), func(value string) string {
+		if rotateErr != nil {
+			return value
+		}
+		plaintext, err := Decrypt(oldKey, value)
+		if err != nil {
+			rotateErr = err
+			return value
+		}
+		value, rotateErr = Encrypt(newKey, plaintext)
+		n++
+		return value
+	})
+	if rotateErr != nil {
+		return 0, fmt.Errorf("%s: %w", path, rotateErr)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, os.WriteFile(path, []byte(rotated), info.Mode())
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("config: encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
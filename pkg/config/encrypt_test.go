@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func encrypt(t *testing.T, key []byte, plaintext string) string {
+	t.Helper()
+	value, err := Encrypt(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return value
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := newKey(t)
+	for _, plaintext := range []string{"hunter2", "", "ünïcode ✓"} {
+		value := encrypt(t, key, plaintext)
+		if !IsEncrypted(value) || plaintext != "" && strings.Contains(value, plaintext) {
+			t.Errorf("Encrypt(%q) = %q", plaintext, value)
+		}
+		got, err := Decrypt(key, value)
+		if err != nil || got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, got, err)
+		}
+	}
+
+	if encrypt(t, key, "hunter2") == encrypt(t, key, "hunter2") {
+		t.Error("Encrypt reuses its nonce")
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	key := newKey(t)
+	tests := []struct {
+		name  string
+		key   []byte
+		value string
+	}{
+		{name: "wrong key", key: newKey(t), value: encrypt(t, key, "hunter2")},
+		{name: "short key", key: key[:16], value: encrypt(t, key, "hunter2")},
+		{name: "not encrypted", key: key, value: "hunter2"},
+		{name: "bad base64", key: key, value: "ENC[AES256_GCM,!!!]"},
+		{name: "too short", key: key, value: "ENC[AES256_GCM,AAAA]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Decrypt(tt.key, tt.value); err == nil {
+				t.Errorf("Decrypt = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := newKey(t)
+	if got, err := ParseKey(EncodeKey(key) + "\n"); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("ParseKey(EncodeKey(key)) = %x, %v", got, err)
+	}
+	for _, s := range []string{"not base64!", EncodeKey(key[:16])} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) accepted", s)
+		}
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	oldKey, newKey := newKey(t), newKey(t)
+	path := filepath.Join(t.TempDir(), "prod.yml")
+	content := fmt.Sprintf("# passwords\nredis:\n  password: %s\ndatabase:\n  mysql:\n    password: %s # primary\n    address: db:3306\n",
+		encrypt(t, oldKey, "redis-pass"), encrypt(t, oldKey, "mysql-pass"))
+	if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RotateKey(path, newKey, oldKey); err == nil {
+		t.Fatal("RotateKey accepted the wrong old key")
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Fatal("RotateKey with the wrong old key changed the file")
+	}
+
+	n, err := RotateKey(path, oldKey, newKey)
+	if err != nil || n != 2 {
+		t.Fatalf("RotateKey = %d, %v, want 2 values", n, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := encryptedValue.FindAllString(string(data), -1)
+	for i, want := range []string{"redis-pass", "mysql-pass"} {
+		if got, err := Decrypt(newKey, values[i]); err != nil || got != want {
+			t.Errorf("value %d = %q, %v with the new key, want %q", i, got, err, want)
+		}
+		if _, err := Decrypt(oldKey, values[i]); err == nil {
+			t.Errorf("value %d still opens with the old key", i)
+		}
+	}
+	if rest := encryptedValue.ReplaceAllString(string(data), "X"); rest != "# passwords\nredis:\n  password: X\ndatabase:\n  mysql:\n    password: X # primary\n    address: db:3306\n" {
+		t.Errorf("RotateKey changed the rest of the file:\n%s", rest)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode %v, %v, want 0640", info.Mode(), err)
+	}
+}
+
+func TestLoadDecrypts(t *testing.T) {
+	key := newKey(t)
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "info"))
+	writeConfig(t, dir, "local.yml", "redis:\n  password: "+encrypt(t, key, "hunter2")+"\n")
+
+	var errs ValidationErrors
+	_, err := NewLoader(LoaderOptions{ConfigDir: dir, EnvPrefix: "TEST"}).Load()
+	if !errors.As(err, &errs) || errs[0].Key != "redis.password" || errs[0].Message != ErrNoKey.Error() {
+		t.Errorf("Load without a key = %v, want ErrNoKey for redis.password", err)
+	}
+
+	t.Setenv(EnvName("TEST", KeyKey), EncodeKey(key))
+	cfg, err := NewLoader(LoaderOptions{ConfigDir: dir, EnvPrefix: "TEST"}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Redis.Password != "hunter2" {
+		t.Errorf("redis.password = %q, want the decrypted value", cfg.Redis.Password)
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// Redacted replaces the value of secret keys in explanations.
+	Redacted = "******"
+
+	// SourceDefault is the Source of values coming from the loader defaults.
+	SourceDefault = "default"
+	// SourceEnvPrefix prefixes the variable name in the Source of values
+	// coming from the environment, e.g. "env:APP1_LOGGER_LEVEL".
+	SourceEnvPrefix = "env:"
+)
+
+// Origin explains the effective value of a config key.
+type Origin struct {
+	Key   string
+	Value interface{}
+	// Source is the layer Value comes from: SourceDefault, a config file
+	// path or an environment variable. It is empty when the key is unset.
+	Source string
+	// Overridden lists the values of lower layers shadowed by Value,
+	// from the lowest layer up.
+	Overridden []LayerValue
+}
+
+// LayerValue is the value a single layer sets for a key.
+type LayerValue struct {
+	Source string
+	Value  interface{}
+}
+
+// layer is a flattened set of keys set by one source, keyed by lowercased key.
+type layer struct {
+	source string
+	values map[string]interface{}
+}
+
+// Explain layers the config sources like Load does and reports, for every
+// key, the effective value, where it comes from and what it overrides.
+// Values of keys tagged `secret:"true"` are Redacted. The config is not
+// validated, so Explain also works on a config Load rejects.
+func (l *Loader) Explain() ([]Origin, error) {
+	if err := l.read(); err != nil {
+		return nil, err
+	}
+
+	layers, err := l.layers()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := keyFields(reflect.TypeOf(Config{}))
+	canonical := make(map[string]string, len(fields))
+	secrets := make(map[string]bool)
+	// lists of sections, whose items may hold secrets
+	lists := make(map[string]reflect.Type)
+	var keys []string
+	for _, kf := range fields {
+		lower := strings.ToLower(kf.Key)
+		canonical[lower] = kf.Key
+		if kf.Field.Tag.Get("secret") == "true" {
+			secrets[lower] = true
+			// A deprecated key holds the same secret.
+			if legacy, ok := legacyKey(kf.Key); ok {
+				secrets[strings.ToLower(legacy)] = true
+			}
+		}
+		if t := kf.Field.Type; t.Kind() == reflect.Slice && isSection(t.Elem()) {
+			lists[lower] = t.Elem()
+		}
+		if kf.Field.Type.Kind() != reflect.Map {
+			keys = append(keys, lower)
+		}
+	}
+
+	// Map entries and unknown keys only exist in the layers that set them.
+	var extra []string
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key] = true
+	}
+	for _, ly := range layers {
+		for key := range ly.values {
+			if !seen[key] {
+				seen[key] = true
+				extra = append(extra, key)
+			}
+		}
+	}
+	sort.Strings(extra)
+	keys = append(keys, extra...)
+
+	origins := make([]Origin, 0, len(keys))
+	for _, key := range keys {
+		origin := Origin{Key: canonicalKey(canonical, key)}
+		for _, ly := range layers {
+			value, ok := ly.values[key]
+			if !ok {
+				continue
+			}
+			if secrets[key] && value != nil && value != "" {
+				value = Redacted
+			}
+			if t, ok := lists[key]; ok {
+				value = redactItems(value, t)
+			}
+			if origin.Source != "" {
+				origin.Overridden = append(origin.Overridden, LayerValue{Source: origin.Source, Value: origin.Value})
+			}
+			origin.Value, origin.Source = value, ly.source
+		}
+		origins = append(origins, origin)
+	}
+
+	return origins, nil
+}
+
+// layers returns the sources read by the last read, from the lowest up.
+func (l *Loader) layers() ([]layer, error) {
+	defaults := DefaultValues()
+	for key, value := range l.opts.Defaults {
+		defaults[key] = value
+	}
+	layers := []layer{{source: SourceDefault, values: lowerKeys(defaults)}}
+
+	for _, file := range l.files {
+		settings, _, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]interface{})
+		flatten(values, "", settings)
+		layers = append(layers, layer{source: file, values: values})
+	}
+
+	// Each variable is a layer of its own so its name can be reported.
+	// The variables of a key are layered from the lowest precedence up.
+	for key, names := range l.envKeys {
+		for i := len(names) - 1; i >= 0; i-- {
+			if value, ok := lookupEnv(names[i]); ok {
+				layers = append(layers, layer{
+					source: SourceEnvPrefix + names[i],
+					values: map[string]interface{}{key: value},
+				})
+			}
+		}
+	}
+
+	return layers, nil
+}
+
+// redactItems returns a copy of the list value with the secret fields of
+// its items, sections of type t, Redacted.
+func redactItems(value interface{}, t reflect.Type) interface{} {
+	items, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+
+	redacted := make([]interface{}, len(items))
+	for i, item := range items {
+		redacted[i] = item
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		copied := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if f, ok := fieldByKey(t, k); ok && f.Tag.Get("secret") == "true" && v != nil && v != "" {
+				v = Redacted
+			}
+			copied[k] = v
+		}
+		redacted[i] = copied
+	}
+
+	return redacted
+}
+
+// fieldByKey returns the field of struct type t whose key is name, ignoring case.
+func fieldByKey(t reflect.Type, name string) (reflect.StructField, bool) {
+	for _, kf := range keyFields(t) {
+		if strings.EqualFold(kf.Key, name) {
+			return kf.Field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func canonicalKey(canonical map[string]string, key string) string {
+	if c, ok := canonical[key]; ok {
+		return c
+	}
+	// Map entries keep the canonical spelling of the map key.
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		if c, ok := canonical[key[:i]]; ok {
+			return c + key[i:]
+		}
+	}
+
+	return key
+}
+
+func lowerKeys(m map[string]interface{}) map[string]interface{} {
+	lowered := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		lowered[strings.ToLower(key)] = value
+	}
+
+	return lowered
+}
+
+// flatten stores the leaves of the nested settings into dst by dotted key.
+func flatten(dst map[string]interface{}, prefix string, settings map[string]interface{}) {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(dst, key, nested)
+			continue
+		}
+		dst[key] = value
+	}
+}
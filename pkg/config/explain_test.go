@@ -0,0 +1,63 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", `logger:
+  level: info
+redis:
+  password: hunter2
+  sentinelPassword: ""
+database:
+  replicas:
+    - address: replica:3306
+      username: reader
+      password: s3cret
+`)
+	t.Setenv("TEST_REDIS_PASSWORD", "from-env")
+	t.Setenv("TEST_LOGGER_LEVEL", "debug")
+
+	origins, err := NewLoader(LoaderOptions{ConfigDir: dir, EnvPrefix: "TEST"}).Explain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKey := make(map[string]Origin, len(origins))
+	for _, o := range origins {
+		byKey[o.Key] = o
+	}
+
+	base := filepath.Join(dir, "base.yml")
+	want := []Origin{
+		{
+			Key:        "logger.level",
+			Value:      "debug",
+			Source:     SourceEnvPrefix + "TEST_LOGGER_LEVEL",
+			Overridden: []LayerValue{{Source: base, Value: "info"}},
+		},
+		{
+			Key:        "redis.password",
+			Value:      Redacted,
+			Source:     SourceEnvPrefix + "TEST_REDIS_PASSWORD",
+			Overridden: []LayerValue{{Source: base, Value: Redacted}},
+		},
+		{Key: "redis.sentinelPassword", Value: "", Source: base},
+		{
+			Key: "database.replicas",
+			Value: []interface{}{map[string]interface{}{
+				"address": "replica:3306", "username": "reader", "password": Redacted,
+			}},
+			Source: base,
+		},
+		{Key: "database.mysql.address"},
+	}
+	for _, w := range want {
+		if got := byKey[w.Key]; !reflect.DeepEqual(got, w) {
+			t.Errorf("%s explained as %+v, want %+v", w.Key, got, w)
+		}
+	}
+}
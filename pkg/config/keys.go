@@ -0,0 +1,124 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	locationType = reflect.TypeOf(time.Location{})
+)
+
+// keyField is a leaf of the config tree addressed by its full key,
+// e.g. "database.mysql.readTimeout".
+type keyField struct {
+	Key   string
+	Field reflect.StructField
+}
+
+// keyFields lists the leaf keys of the struct type t. Keys are built from
+// the mapstructure tags, falling back to the lowercased field name.
+func keyFields(t reflect.Type) []keyField {
+	return appendKeyFields(nil, "", t)
+}
+
+func appendKeyFields(fields []keyField, prefix string, t reflect.Type) []keyField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, squash, ok := fieldKey(f)
+		if !ok {
+			continue
+		}
+		if squash {
+			fields = appendKeyFields(fields, prefix, f.Type)
+			continue
+		}
+
+		key := joinKey(prefix, name)
+		if isSection(f.Type) {
+			fields = appendKeyFields(fields, key, f.Type)
+			continue
+		}
+		fields = append(fields, keyField{Key: key, Field: f})
+	}
+
+	return fields
+}
+
+// fieldKey returns the key of f taken from its mapstructure tag, falling
+// back to the lowercased field name. squash is set for embedded sections
+// whose keys are promoted to the parent, and ok is false for skipped fields.
+func fieldKey(f reflect.StructField) (name string, squash, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+
+	name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if name == "-" {
+		return "", false, false
+	}
+	if f.Anonymous && (opts == "squash" || name == "") && isSection(f.Type) {
+		return "", true, true
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+
+	return name, false, true
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// isSection reports whether t, or the type t points to, is a struct
+// holding nested keys rather than a single value.
+func isSection(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct && t != locationType
+}
+
+// EnvName returns the environment variable overriding key, e.g.
+// EnvName("APP1", "logger.level") is "APP1_LOGGER_LEVEL".
+// Entries of map keys such as database.mysql.params are set with a suffix:
+// APP1_DATABASE_MYSQL_PARAMS_CHARSET sets database.mysql.params.charset.
+func EnvName(prefix, key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if prefix == "" {
+		return name
+	}
+
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// lookup walks settings along the dotted key.
+func lookup(settings map[string]interface{}, key string) interface{} {
+	var value interface{} = settings
+	for _, part := range splitKey(key) {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+
+	return value
+}
+
+// splitKey splits a dotted key into the lowercased parts viper uses.
+func splitKey(key string) []string {
+	return strings.Split(strings.ToLower(key), ".")
+}
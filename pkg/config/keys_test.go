@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		prefix, key, want string
+	}{
+		{prefix: "APP1", key: "logger.level", want: "APP1_LOGGER_LEVEL"},
+		{prefix: "app1", key: "database.mysql.readTimeout", want: "APP1_DATABASE_MYSQL_READTIMEOUT"},
+		{prefix: "", key: "http.port", want: "HTTP_PORT"},
+		{prefix: "APP1", key: "database.mysql.params.charset", want: "APP1_DATABASE_MYSQL_PARAMS_CHARSET"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(tt.prefix, tt.key); got != tt.want {
+			t.Errorf("EnvName(%q, %q) = %q, want %q", tt.prefix, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", `server:
+  mode: dev
+logger:
+  level: info
+database:
+  driver: sqlite
+  sqlite:
+    path: ":memory:"
+    params:
+      cache: private
+redis:
+  addr: localhost:6379
+  poolSize: 10
+featureFlags:
+  beta:
+    percentage: 10
+`)
+
+	env := map[string]string{
+		"TEST_LOGGER_LEVEL":                   "debug",
+		"TEST_REDIS_POOLSIZE":                 "20",
+		"TEST_DATABASE_SQLITE_PATH":           "/tmp/app.db",
+		"TEST_DATABASE_RETRY_INITIALINTERVAL": "2s",
+		"TEST_DATABASE_SQLITE_PARAMS_CACHE":   "shared",
+		"TEST_DATABASE_SQLITE_PARAMS_MODE":    "rwc",
+		"TEST_FEATUREFLAGS_BETA_ENABLED":      "true",
+		"TEST_FEATUREFLAGS_NEW_UI_PERCENTAGE": "50",
+		"TEST_FEATUREFLAGS_NEW_UI_TENANTS":    "acme globex",
+		"OTHER_LOGGER_LEVEL":                  "error",
+		"TEST_DATABASE_SQLITE_PARAMS_":        "ignored",
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	cfg, err := NewLoader(LoaderOptions{ConfigDir: dir, EnvPrefix: "TEST"}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		key       string
+		got, want interface{}
+	}{
+		{"logger.level", cfg.Logger.LogLevel, "debug"},
+		{"redis.poolSize", cfg.Redis.PoolSize, 20},
+		{"database.sqlite.path", cfg.Database.SQLite.Path, "/tmp/app.db"},
+		{"database.retry.initialInterval", cfg.Database.Retry.InitialInterval, 2 * time.Second},
+		{"database.sqlite.params", fmt.Sprint(cfg.Database.SQLite.Params), "map[cache:shared mode:rwc]"},
+		{"featureFlags.beta", fmt.Sprint(cfg.FeatureFlags["beta"]), "{true 10 [] []}"},
+		{"featureFlags.new_ui", fmt.Sprint(cfg.FeatureFlags["new_ui"]), "{false 50 [] [acme globex]}"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.key, c.got, c.want)
+		}
+	}
+}
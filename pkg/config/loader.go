@@ -0,0 +1,382 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/constants"
+)
+
+const (
+	// BaseConfig is the name of the config file every overlay is merged over.
+	BaseConfig = "base"
+	// LocalOverlay names an optional, git-ignored file merged over every
+	// other overlay for local development.
+	LocalOverlay = "local"
+)
+
+// ConfigExts are the supported config file formats.
+var ConfigExts = []string{constants.Yaml, constants.Yml, constants.Json, constants.Toml}
+
+// LoaderOptions configures a Loader.
+type LoaderOptions struct {
+	// ConfigDir is the folder holding the base config and its overlays.
+	// When empty only Files are read.
+	ConfigDir string
+	// Environment selects the overlay merged over base, e.g. "prod".
+	Environment string
+	// Region selects the overlay merged over the environment one, e.g. "eu-west".
+	Region string
+	// EnvPrefix is prepended to the environment variables used for
+	// overrides, e.g. "APP1" reads APP1_DATABASE_MYSQL_ADDRESS. See EnvName.
+	EnvPrefix string
+	// Files are extra config files merged, in order, after the overlays.
+	Files []string
+	// Defaults are applied below every file, keyed by config key
+	// such as "http.port". They extend and override DefaultValues.
+	Defaults map[string]interface{}
+	// SecretProviders resolve string values written as "<scheme>://<ref>",
+	// keyed by scheme. They extend and override DefaultSecretProviders.
+	SecretProviders map[string]SecretProvider
+	// EncryptionKey decrypts ENC[AES256_GCM,...] values. When nil the key
+	// is read by KeyFromEnv with EnvPrefix once an encrypted value is found.
+	EncryptionKey []byte
+}
+
+// Loader reads a Config with its own viper instance, so several configs
+// can be loaded in one process independently of each other.
+//
+// Files are merged in order: base, the Environment overlay, the Region
+// overlay and LocalOverlay when present, then Files. Each is looked up in
+// ConfigDir in any of the ConfigExts formats. Keys are case-insensitive,
+// so "readTimeout" in YAML, JSON and TOML all set the same key.
+// A Loader is not safe for concurrent use.
+type Loader struct {
+	opts  LoaderOptions
+	v     *viper.Viper
+	files []string
+	// envKeys maps the lowercased keys bound to the environment to their
+	// variables, the one taking precedence first.
+	envKeys  map[string][]string
+	warnings []string
+}
+
+// NewLoader creates a Loader for opts.
+func NewLoader(opts LoaderOptions) *Loader {
+	return &Loader{opts: opts}
+}
+
+// DefaultValues returns the values used for keys no config file sets.
+func DefaultValues() map[string]interface{} {
+	values := map[string]interface{}{
+		"http.port":           defaultHTTPPort,
+		"http.maxHeaderBytes": defaultHTTPMaxHeaderMegabytes,
+		"http.readTimeout":    defaultHTTPRWTimeout,
+		"http.writeTimeout":   defaultHTTPRWTimeout,
+
+		"database.driver":               DriverMySQL,
+		"database.pool.maxOpenConns":    defaultPoolMaxOpenConns,
+		"database.pool.maxIdleConns":    defaultPoolMaxIdleConns,
+		"database.pool.connMaxLifetime": defaultPoolConnMaxLifetime,
+		"database.readPolicy":           ReadRandom,
+		"database.readYourWritesWindow": defaultReadYourWritesWindow,
+		"database.log.level":            SQLLogWarn,
+		"database.log.slowThreshold":    defaultSQLLogSlowThreshold,
+
+		"redis.mode": RedisStandalone,
+
+		"outbox.pollInterval":          defaultOutboxPollInterval,
+		"outbox.batchSize":             defaultOutboxBatchSize,
+		"outbox.streamPrefix":          defaultOutboxStreamPrefix,
+		"outbox.retry.maxAttempts":     defaultOutboxMaxAttempts,
+		"outbox.retry.initialInterval": defaultOutboxInitialInterval,
+		"outbox.retry.maxInterval":     defaultOutboxMaxInterval,
+		"outbox.retry.multiplier":      defaultRetryMultiplier,
+		"outbox.retry.jitter":          defaultRetryJitter,
+
+		"rateLimit.prefix": defaultRateLimitPrefix,
+
+		"worker.concurrency":      defaultWorkerConcurrency,
+		"worker.block":            defaultWorkerBlock,
+		"worker.minIdle":          defaultWorkerMinIdle,
+		"worker.claimInterval":    defaultWorkerClaimInterval,
+		"worker.maxDeliveries":    defaultWorkerMaxDeliveries,
+		"worker.deadLetterSuffix": defaultWorkerDeadLetterSuffix,
+		"worker.drainTimeout":     defaultWorkerDrainTimeout,
+	}
+	for _, section := range []Section{SectionDatabase, SectionRedis} {
+		prefix := string(section) + ".retry."
+		values[prefix+"maxAttempts"] = defaultRetryMaxAttempts
+		values[prefix+"initialInterval"] = defaultRetryInitialInterval
+		values[prefix+"maxInterval"] = defaultRetryMaxInterval
+		values[prefix+"multiplier"] = defaultRetryMultiplier
+		values[prefix+"jitter"] = defaultRetryJitter
+	}
+
+	return values
+}
+
+// Load reads the config files, applies environment overrides, resolves
+// secret references, decrypts encrypted values and validates the result.
+// Every call starts from a fresh viper instance.
+func (l *Loader) Load() (*Config, error) {
+	if err := l.read(); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := l.unmarshal(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := l.resolveSecrets(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// read layers defaults, config files and environment variables
+// into a fresh viper instance.
+func (l *Loader) read() error {
+	l.v = viper.New()
+	l.files = nil
+	l.envKeys = make(map[string][]string)
+	l.warnings = nil
+
+	l.populateDefaults()
+
+	if err := l.parseConfigFiles(); err != nil {
+		return err
+	}
+
+	// Override configuration from environment settings
+	return l.bindEnv()
+}
+
+// Warnings returns the deprecations found by the last Load, such as
+// numeric values for keys that now take a duration or a name.
+func (l *Loader) Warnings() []string {
+	return l.warnings
+}
+
+// Environment returns the overlay environment of the Loader, e.g. "prod".
+func (l *Loader) Environment() string {
+	return l.opts.Environment
+}
+
+// Files returns the config files read by the last Load, in merge order.
+func (l *Loader) Files() []string {
+	return l.files
+}
+
+// unmarshal decodes every section from the merged settings. Unlike
+// viper.UnmarshalKey this sees keys bound to environment variables.
+func (l *Loader) unmarshal(cfg *Config) error {
+	settings := l.v.AllSettings()
+	l.warnings = append(l.warnings, upgradeLegacy(settings)...)
+	for _, section := range Sections {
+		if err := decode(lookup(settings, string(section)), cfg.Section(section)); err != nil {
+			return fmt.Errorf("%s: %w", section, err)
+		}
+	}
+
+	return nil
+}
+
+// bindEnv binds every key of Config to its EnvName. Entries of map keys
+// are discovered from the variables set in the environment.
+func (l *Loader) bindEnv() error {
+	environ := os.Environ()
+	for _, kf := range keyFields(reflect.TypeOf(Config{})) {
+		names := []string{EnvName(l.opts.EnvPrefix, kf.Key)}
+		// Variables named after a deprecated key still apply, with a
+		// warning, below the ones named after the key.
+		if legacy, ok := legacyKey(kf.Key); ok {
+			names = append(names, EnvName(l.opts.EnvPrefix, legacy))
+		}
+		if err := l.bindEnvField(environ, kf.Key, names, kf.Field.Type); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Loader) bindEnvField(environ []string, key string, names []string, t reflect.Type) error {
+	if t.Kind() != reflect.Map {
+		return l.bindEnvKey(key, names...)
+	}
+
+	// entries are the map entries set by any of the names, in the order found.
+	var entries []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for _, kv := range environ {
+			env, _, _ := strings.Cut(kv, "=")
+			entry := strings.TrimPrefix(env, name+"_")
+			if entry == env || entry == "" || seen[entry] {
+				continue
+			}
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, entry := range entries {
+		vars := make([]string, len(names))
+		for i, name := range names {
+			vars[i] = name + "_" + entry
+		}
+		if isSection(t.Elem()) {
+			// Struct entries are set field by field, e.g.
+			// APP1_FEATUREFLAGS_NEW_UI_ENABLED sets featureFlags.new_ui.enabled.
+			i := strings.LastIndex(entry, "_")
+			if i <= 0 {
+				continue
+			}
+			entry = entry[:i] + "." + entry[i+1:]
+		}
+		if err := l.bindEnvKey(key+"."+entry, vars...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindEnvKey binds key to names, the first one set taking precedence.
+func (l *Loader) bindEnvKey(key string, names ...string) error {
+	key = strings.ToLower(key)
+	l.envKeys[key] = names
+	for _, name := range names[1:] {
+		if _, ok := lookupEnv(name); ok {
+			l.warnings = append(l.warnings, fmt.Sprintf("%s is deprecated, use %s", name, names[0]))
+		}
+	}
+
+	return l.v.BindEnv(append([]string{key}, names...)...)
+}
+
+// lookupEnv reports a variable the way viper does: empty values are unset.
+func lookupEnv(name string) (string, bool) {
+	value, ok := os.LookupEnv(name)
+
+	return value, ok && value != ""
+}
+
+// overlay is a config file looked up by name in ConfigDir.
+type overlay struct {
+	name     string
+	optional bool
+}
+
+// overlays returns the chain merged from ConfigDir:
+// base, Environment, Region and LocalOverlay.
+func (l *Loader) overlays() []overlay {
+	chain := []overlay{{name: BaseConfig}}
+	if l.opts.Environment != "" {
+		chain = append(chain, overlay{name: l.opts.Environment})
+	}
+	if l.opts.Region != "" {
+		chain = append(chain, overlay{name: l.opts.Region})
+	}
+
+	return append(chain, overlay{name: LocalOverlay, optional: true})
+}
+
+func (l *Loader) parseConfigFiles() error {
+	if l.opts.ConfigDir != "" {
+		for _, o := range l.overlays() {
+			file, err := FindConfigFile(l.opts.ConfigDir, o.name)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				if o.optional {
+					continue
+				}
+				return fmt.Errorf("config: no %s config file in %s", o.name, l.opts.ConfigDir)
+			}
+			if err := l.mergeFile(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range l.opts.Files {
+		if err := l.mergeFile(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Loader) mergeFile(file string) error {
+	settings, warnings, err := readFile(file)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		l.warnings = append(l.warnings, file+": "+warning)
+	}
+	if err := l.v.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("config: %s: %w", file, err)
+	}
+	l.files = append(l.files, file)
+
+	return nil
+}
+
+// readFile returns the settings of a single config file with its
+// deprecated keys moved, and a warning for each of them.
+func readFile(file string) (map[string]interface{}, []string, error) {
+	fv := viper.New()
+	fv.SetConfigFile(file)
+	if err := fv.ReadInConfig(); err != nil {
+		return nil, nil, fmt.Errorf("config: %s: %w", file, err)
+	}
+	settings := fv.AllSettings()
+
+	return settings, moveLegacyKeys(settings), nil
+}
+
+// FindConfigFile returns the file named name in dir with one of the
+// ConfigExts, or "" if there is none. Having the same name in several
+// formats is an error, so the file read never depends on lookup order.
+func FindConfigFile(dir, name string) (string, error) {
+	var found []string
+	for _, ext := range ConfigExts {
+		file := filepath.Join(dir, name+"."+ext)
+		if _, err := os.Stat(file); err == nil {
+			found = append(found, file)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	}
+
+	return "", fmt.Errorf("config: ambiguous %s config, found %s", name, strings.Join(found, ", "))
+}
+
+func (l *Loader) populateDefaults() {
+	for key, value := range DefaultValues() {
+		l.v.SetDefault(key, value)
+	}
+	for key, value := range l.opts.Defaults {
+		l.v.SetDefault(key, value)
+	}
+}
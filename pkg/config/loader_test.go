@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyMySQLLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", "database:\n  mysql:\n    address: base\n    user: base\n")
+	writeConfig(t, dir, "prod.yml", "mysql:\n  address: prod\n  password: hunter2\n")
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+		// warnings is the number of deprecated keys and variables used.
+		warnings int
+	}{
+		{name: "a later file with the legacy key wins", want: "prod", warnings: 1},
+		{name: "legacy variable", env: map[string]string{"TEST_MYSQL_ADDRESS": "legacy-env"}, want: "legacy-env", warnings: 2},
+		{
+			name:     "variable named after the key wins over the legacy one",
+			env:      map[string]string{"TEST_MYSQL_ADDRESS": "legacy-env", "TEST_DATABASE_MYSQL_ADDRESS": "env"},
+			want:     "env",
+			warnings: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			l := NewLoader(LoaderOptions{ConfigDir: dir, Environment: "prod", EnvPrefix: "TEST"})
+			if err := l.read(); err != nil {
+				t.Fatal(err)
+			}
+			if got := l.v.GetString("database.mysql.address"); got != tt.want {
+				t.Errorf("address = %q, want %q", got, tt.want)
+			}
+			if got := l.v.GetString("database.mysql.user"); got != "base" {
+				t.Errorf("user = %q, want the base one", got)
+			}
+			if len(l.Warnings()) != tt.warnings {
+				t.Errorf("warnings = %q", l.Warnings())
+			}
+
+			origins, err := l.Explain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, o := range origins {
+				switch o.Key {
+				case "database.mysql.address":
+					if o.Value != tt.want {
+						t.Errorf("explained address = %v, want %q", o.Value, tt.want)
+					}
+				case "database.mysql.password":
+					if o.Value != Redacted || o.Source != filepath.Join(dir, "prod.yml") {
+						t.Errorf("explained password = %v from %s, want it redacted from prod.yml", o.Value, o.Source)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import "time"
+
+const (
+	defaultOutboxPollInterval    = time.Second
+	defaultOutboxBatchSize       = 100
+	defaultOutboxStreamPrefix    = "events:"
+	defaultOutboxMaxAttempts     = 20
+	defaultOutboxInitialInterval = time.Second
+	defaultOutboxMaxInterval     = 5 * time.Minute
+)
+
+// OutboxConfig configures the relay publishing the messages of the
+// outbox table. Retry spaces the attempts to publish a message; after
+// Retry.MaxAttempts the message is marked failed and left in the table.
+type OutboxConfig struct {
+	Enabled      bool          `yaml:"enabled" mapstructure:"enabled"`
+	PollInterval time.Duration `yaml:"pollInterval" mapstructure:"pollInterval" validate:"gte=0"`
+	BatchSize    int           `yaml:"batchSize" mapstructure:"batchSize" validate:"gte=0"`
+	Retry        RetryConfig   `yaml:"retry" mapstructure:"retry"`
+
+	// StreamPrefix and StreamMaxLen apply to the Redis Streams the
+	// messages are published to, named StreamPrefix + topic and trimmed
+	// to about StreamMaxLen entries if set.
+	StreamPrefix string `yaml:"streamPrefix" mapstructure:"streamPrefix"`
+	StreamMaxLen int64  `yaml:"streamMaxLen" mapstructure:"streamMaxLen" validate:"gte=0"`
+}
+
+// WithDefaults returns o with the zero fields set to the loader defaults,
+// for configs built without a Loader.
+func (o OutboxConfig) WithDefaults() OutboxConfig {
+	if o.PollInterval == 0 {
+		o.PollInterval = defaultOutboxPollInterval
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = defaultOutboxBatchSize
+	}
+	if o.StreamPrefix == "" {
+		o.StreamPrefix = defaultOutboxStreamPrefix
+	}
+	if o.Retry.MaxAttempts == 0 {
+		o.Retry.MaxAttempts = defaultOutboxMaxAttempts
+	}
+	if o.Retry.InitialInterval == 0 {
+		o.Retry.InitialInterval = defaultOutboxInitialInterval
+	}
+	if o.Retry.MaxInterval == 0 {
+		o.Retry.MaxInterval = defaultOutboxMaxInterval
+	}
+	o.Retry = o.Retry.WithDefaults()
+
+	return o
+}
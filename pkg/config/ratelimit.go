@@ -0,0 +1,87 @@
+package config
+
+import "time"
+
+const (
+	// RateLimitTokenBucket and RateLimitSlidingWindow are the rate
+	// limiting algorithms.
+	RateLimitTokenBucket   = "tokenBucket"
+	RateLimitSlidingWindow = "slidingWindow"
+
+	// RateLimitByIP, RateLimitByUser, RateLimitByAPIKey, RateLimitByTenant
+	// and RateLimitGlobal are what a rate limit rule counts requests by.
+	RateLimitByIP     = "ip"
+	RateLimitByUser   = "user"
+	RateLimitByAPIKey = "apiKey"
+	RateLimitByTenant = "tenant"
+	RateLimitGlobal   = "global"
+
+	defaultRateLimitPrefix = "ratelimit:"
+)
+
+type (
+	// RateLimitConfig configures the rate limits of the HTTP API. Every
+	// rule matching a request counts it, and the request is rejected as
+	// soon as one of them is exceeded. The counters are kept in Redis,
+	// under keys starting with Prefix, and in memory while Redis fails.
+	RateLimitConfig struct {
+		Enabled bool            `yaml:"enabled" mapstructure:"enabled"`
+		Prefix  string          `yaml:"prefix" mapstructure:"prefix"`
+		Rules   []RateLimitRule `yaml:"rules" mapstructure:"rules" validate:"dive"`
+	}
+
+	// RateLimitRule allows Limit requests per Period to the Routes, for
+	// each value of Key. Routes are Echo route paths, optionally preceded
+	// by a method and ending with "*" to match a prefix, e.g.
+	// "POST /api/v1/users" or "/api/*". Prefixes also match the request
+	// path, so requests under them to unknown routes are counted; a rule
+	// without routes matches every request. Requests without an
+	// authenticated user, tenant or API key for Key are counted by IP
+	// instead.
+	//
+	// With the token bucket algorithm, Burst requests, Limit by default,
+	// may be made at once, and the bucket refills at Limit per Period.
+	// The sliding window allows Limit requests in any Period.
+	RateLimitRule struct {
+		Name      string        `yaml:"name" mapstructure:"name" validate:"required"`
+		Routes    []string      `yaml:"routes" mapstructure:"routes"`
+		Key       string        `yaml:"key" mapstructure:"key" validate:"omitempty,oneof=ip user apiKey tenant global"`
+		Algorithm string        `yaml:"algorithm" mapstructure:"algorithm" validate:"omitempty,oneof=tokenBucket slidingWindow"`
+		Limit     int           `yaml:"limit" mapstructure:"limit" validate:"gt=0"`
+		Period    time.Duration `yaml:"period" mapstructure:"period" validate:"gt=0"`
+		Burst     int           `yaml:"burst" mapstructure:"burst" validate:"gte=0"`
+
+		// Tenants override Limit and Burst for some tenants.
+		Tenants []TenantRateLimit `yaml:"tenants" mapstructure:"tenants" validate:"dive"`
+	}
+
+	// TenantRateLimit is the limit of a rule for the tenant Tenant.
+	TenantRateLimit struct {
+		Tenant string `yaml:"tenant" mapstructure:"tenant" validate:"required"`
+		Limit  int    `yaml:"limit" mapstructure:"limit" validate:"gt=0"`
+		Burst  int    `yaml:"burst" mapstructure:"burst" validate:"gte=0"`
+	}
+)
+
+// WithDefaults returns r with the zero fields set to the loader defaults,
+// for configs built without a Loader. The rules default to counting by
+// IP with a token bucket.
+func (r RateLimitConfig) WithDefaults() RateLimitConfig {
+	if r.Prefix == "" {
+		r.Prefix = defaultRateLimitPrefix
+	}
+
+	rules := make([]RateLimitRule, len(r.Rules))
+	for i, rule := range r.Rules {
+		if rule.Key == "" {
+			rule.Key = RateLimitByIP
+		}
+		if rule.Algorithm == "" {
+			rule.Algorithm = RateLimitTokenBucket
+		}
+		rules[i] = rule
+	}
+	r.Rules = rules
+
+	return r
+}
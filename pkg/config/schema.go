@@ -0,0 +1,276 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	schemaDialect   = "https://json-schema.org/draft/2020-12/schema"
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+)
+
+// Enum is implemented by config types restricted to a fixed set of values.
+type Enum interface {
+	Values() []interface{}
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// SchemaOptions configures Schema.
+type SchemaOptions struct {
+	Title string
+	// Partial drops required keys, for overlays that only set some keys.
+	Partial bool
+	// Defaults documents default values by key, see DefaultValues.
+	Defaults map[string]interface{}
+}
+
+// Schema returns a JSON Schema describing the files cfg is loaded from.
+// cfg is Config or a service specific struct embedding it; keys come
+// from the mapstructure tags, constraints from the validate tags and
+// allowed values from types implementing Enum.
+func Schema(cfg interface{}, opts SchemaOptions) map[string]interface{} {
+	g := schemaGenerator{opts: opts, defaults: lowerKeys(opts.Defaults)}
+
+	schema := g.object(reflect.TypeOf(cfg), "")
+	schema["$schema"] = schemaDialect
+	if opts.Title != "" {
+		schema["title"] = opts.Title
+	}
+
+	return schema
+}
+
+type schemaGenerator struct {
+	opts     SchemaOptions
+	defaults map[string]interface{}
+}
+
+func (g schemaGenerator) object(t reflect.Type, prefix string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+	g.addFields(schema, t, prefix)
+
+	return schema
+}
+
+// addFields adds the fields of struct type t to the object schema.
+// Dotted keys such as "cache.ttl" become nested objects.
+func (g schemaGenerator) addFields(schema map[string]interface{}, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, squash, ok := fieldKey(f)
+		if !ok {
+			continue
+		}
+		if squash {
+			g.addFields(schema, f.Type, prefix)
+			continue
+		}
+
+		key := joinKey(prefix, name)
+		parts := strings.Split(name, ".")
+		parent := schema
+		for _, part := range parts[:len(parts)-1] {
+			parent = g.child(parent, part)
+		}
+
+		var prop map[string]interface{}
+		if isSection(f.Type) {
+			prop = g.object(f.Type, key)
+		} else {
+			prop = g.value(f.Type, key)
+		}
+		required := g.applyRules(prop, f)
+		if _, ok := g.defaults[strings.ToLower(key)]; ok {
+			// Keys with a default may be left out of the files.
+			required = false
+		}
+
+		last := parts[len(parts)-1]
+		parent["properties"].(map[string]interface{})[last] = prop
+		// Blocks behind a pointer are optional even with required keys.
+		if required || (hasRequired(prop) && f.Type.Kind() != reflect.Ptr) {
+			markRequired(parent, last)
+		}
+		if !g.opts.Partial {
+			g.addConditions(parent, t, f, last)
+		}
+	}
+}
+
+// addConditions translates the required_if rules of f, a field of struct
+// type t, into if/then clauses of the object schema.
+func (g schemaGenerator) addConditions(schema map[string]interface{}, t reflect.Type, f reflect.StructField, name string) {
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		tag, param, _ := strings.Cut(rule, "=")
+		if tag != "required_if" {
+			continue
+		}
+		fields := strings.Fields(param)
+		if len(fields) != 2 {
+			continue
+		}
+		other, ok := t.FieldByName(fields[0])
+		if !ok {
+			continue
+		}
+		key, _, ok := fieldKey(other)
+		if !ok {
+			continue
+		}
+
+		allOf, _ := schema["allOf"].([]interface{})
+		schema["allOf"] = append(allOf, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{key: map[string]interface{}{"const": fields[1]}},
+				"required":   []string{key},
+			},
+			"then": map[string]interface{}{"required": []string{name}},
+		})
+	}
+}
+
+// child returns the nested object schema named name, creating it if needed.
+func (g schemaGenerator) child(schema map[string]interface{}, name string) map[string]interface{} {
+	props := schema["properties"].(map[string]interface{})
+	if c, ok := props[name].(map[string]interface{}); ok {
+		return c
+	}
+
+	c := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+	props[name] = c
+
+	return c
+}
+
+func (g schemaGenerator) value(t reflect.Type, key string) map[string]interface{} {
+	prop := map[string]interface{}{}
+
+	switch {
+	case t.Implements(enumType):
+		prop["enum"] = reflect.Zero(t).Interface().(Enum).Values()
+	case t == durationType:
+		prop["type"] = []string{"string", "integer"}
+		prop["pattern"] = durationPattern
+	case t == reflect.PtrTo(locationType):
+		prop["type"] = "string"
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			prop["type"] = "string"
+		case reflect.Bool:
+			prop["type"] = "boolean"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			prop["type"] = "integer"
+		case reflect.Float32, reflect.Float64:
+			prop["type"] = "number"
+		case reflect.Slice, reflect.Array:
+			prop["type"] = "array"
+			if isSection(t.Elem()) {
+				prop["items"] = g.object(t.Elem(), key)
+			} else {
+				prop["items"] = g.value(t.Elem(), key)
+			}
+		case reflect.Map:
+			prop["type"] = "object"
+			if isSection(t.Elem()) {
+				prop["additionalProperties"] = g.object(t.Elem(), key)
+			} else {
+				prop["additionalProperties"] = g.value(t.Elem(), key)
+			}
+		}
+	}
+
+	if def, ok := g.defaults[strings.ToLower(key)]; ok {
+		if d, ok := def.(time.Duration); ok {
+			def = d.String()
+		}
+		prop["default"] = def
+	}
+
+	return prop
+}
+
+// applyRules translates the validate tag of f into schema keywords and
+// reports whether the key is required.
+func (g schemaGenerator) applyRules(prop map[string]interface{}, f reflect.StructField) bool {
+	var required bool
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = !g.opts.Partial
+		case "oneof":
+			var values []interface{}
+			for _, v := range strings.Fields(param) {
+				values = append(values, schemaLiteral(f.Type, v))
+			}
+			prop["enum"] = values
+		case "gte", "min":
+			if n, err := strconv.ParseFloat(param, 64); err == nil && isNumeric(f.Type) {
+				prop["minimum"] = n
+			}
+		case "lte", "max":
+			if n, err := strconv.ParseFloat(param, 64); err == nil && isNumeric(f.Type) {
+				prop["maximum"] = n
+			}
+		case "numeric":
+			// Weak decoding accepts numbers for numeric strings, e.g. "port: 8000".
+			prop["type"] = []string{"string", "integer"}
+			prop["pattern"] = "^[0-9]+$"
+		}
+	}
+
+	return required
+}
+
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// schemaLiteral converts a oneof parameter to the JSON type of t.
+func schemaLiteral(t reflect.Type, v string) interface{} {
+	if isNumeric(t) {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+
+	return v
+}
+
+func hasRequired(prop map[string]interface{}) bool {
+	_, ok := prop["required"]
+	return ok
+}
+
+func markRequired(schema map[string]interface{}, name string) {
+	required, _ := schema["required"].([]string)
+	for _, r := range required {
+		if r == name {
+			return
+		}
+	}
+	schema["required"] = append(required, name)
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaMySQL struct {
+	Address string `mapstructure:"address" validate:"required"`
+}
+
+type schemaConfig struct {
+	Driver     string            `mapstructure:"driver" validate:"required,oneof=mysql sqlite"`
+	MySQL      *schemaMySQL      `mapstructure:"mysql" validate:"required_if=Driver mysql"`
+	Port       string            `mapstructure:"port" validate:"required,numeric"`
+	LogType    LogType           `mapstructure:"logType"`
+	Timeout    time.Duration     `mapstructure:"timeout" validate:"required,gte=0"`
+	Percentage int               `mapstructure:"percentage" validate:"gte=0,lte=100"`
+	CacheTTL   time.Duration     `mapstructure:"cache.ttl"`
+	Tags       []string          `mapstructure:"tags"`
+	Params     map[string]string `mapstructure:"params"`
+}
+
+// schemaJSON returns the JSON Schema of schemaConfig decoded as generic JSON.
+func schemaJSON(t *testing.T, opts SchemaOptions) interface{} {
+	t.Helper()
+	data, err := json.Marshal(Schema(schemaConfig{}, opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	return schema
+}
+
+// at returns the value of the decoded JSON at path, or nil.
+func at(value interface{}, path ...string) interface{} {
+	for _, name := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[name]
+	}
+
+	return value
+}
+
+func TestSchema(t *testing.T) {
+	duration := []interface{}{"string", "integer"}
+	schema := schemaJSON(t, SchemaOptions{
+		Title:    "test",
+		Defaults: map[string]interface{}{"timeout": 5 * time.Second},
+	})
+
+	tests := []struct {
+		path []string
+		want interface{}
+	}{
+		{[]string{"$schema"}, schemaDialect},
+		{[]string{"title"}, "test"},
+		// timeout is required but has a default.
+		{[]string{"required"}, []interface{}{"driver", "port"}},
+		{[]string{"properties", "driver", "enum"}, []interface{}{"mysql", "sqlite"}},
+		{[]string{"properties", "port", "type"}, []interface{}{"string", "integer"}},
+		{[]string{"properties", "port", "pattern"}, "^[0-9]+$"},
+		{[]string{"properties", "logType", "enum"}, []interface{}{"zap", "logrus"}},
+		{[]string{"properties", "percentage", "type"}, "integer"},
+		{[]string{"properties", "percentage", "minimum"}, 0.0},
+		{[]string{"properties", "percentage", "maximum"}, 100.0},
+		{[]string{"properties", "timeout", "type"}, duration},
+		{[]string{"properties", "timeout", "pattern"}, durationPattern},
+		{[]string{"properties", "timeout", "default"}, "5s"},
+		{[]string{"properties", "cache", "properties", "ttl", "type"}, duration},
+		{[]string{"properties", "tags", "items", "type"}, "string"},
+		{[]string{"properties", "params", "additionalProperties", "type"}, "string"},
+		{[]string{"properties", "mysql", "required"}, []interface{}{"address"}},
+		{[]string{"allOf"}, []interface{}{map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"driver": map[string]interface{}{"const": "mysql"}},
+				"required":   []interface{}{"driver"},
+			},
+			"then": map[string]interface{}{"required": []interface{}{"mysql"}},
+		}}},
+	}
+	for _, tt := range tests {
+		if got := at(schema, tt.path...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSchemaPartial(t *testing.T) {
+	schema := schemaJSON(t, SchemaOptions{Partial: true})
+
+	for _, path := range [][]string{{"required"}, {"allOf"}, {"properties", "mysql", "required"}} {
+		if got := at(schema, path...); got != nil {
+			t.Errorf("%v = %v in a partial schema", path, got)
+		}
+	}
+	if got := at(schema, "properties", "driver", "enum"); got == nil {
+		t.Error("partial schema lost the allowed values")
+	}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// SecretProvider resolves secret references of a single scheme.
+// ref is the full reference, e.g. "file:///run/secrets/mysql".
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to a SecretProvider.
+type SecretProviderFunc func(ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// FileSecretProvider reads file://<path> references, such as Kubernetes
+// or Docker secret mounts. A trailing newline is dropped.
+type FileSecretProvider struct{}
+
+func (FileSecretProvider) Resolve(ref string) (string, error) {
+	data, err := os.ReadFile(strings.TrimPrefix(ref, "file://"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvSecretProvider reads env://<NAME> references from the environment.
+type EnvSecretProvider struct{}
+
+func (EnvSecretProvider) Resolve(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, "env://")
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+
+	return value, nil
+}
+
+// DefaultSecretProviders returns the providers every Loader knows, by scheme.
+func DefaultSecretProviders() map[string]SecretProvider {
+	return map[string]SecretProvider{
+		"file": FileSecretProvider{},
+		"env":  EnvSecretProvider{},
+	}
+}
+
+// secretResolver replaces references in the values of secret fields,
+// tagged `secret:"true"`, with the secret they point to, and decrypts
+// encrypted values of any field. Values of other fields that merely look
+// like a reference, such as a path or URL, and values whose scheme has no
+// provider are left untouched.
+type secretResolver struct {
+	providers map[string]SecretProvider
+	key       func() ([]byte, error)
+	errs      ValidationErrors
+}
+
+func (l *Loader) secretProviders() map[string]SecretProvider {
+	providers := DefaultSecretProviders()
+	for scheme, provider := range l.opts.SecretProviders {
+		providers[scheme] = provider
+	}
+
+	return providers
+}
+
+// encryptionKey returns the configured key, reading it from the
+// environment on first use.
+func (l *Loader) encryptionKey() ([]byte, error) {
+	if l.opts.EncryptionKey == nil {
+		key, err := KeyFromEnv(l.opts.EnvPrefix)
+		if err != nil {
+			return nil, err
+		}
+		l.opts.EncryptionKey = key
+	}
+
+	return l.opts.EncryptionKey, nil
+}
+
+// resolveSecrets resolves the references in the secret fields of cfg and
+// decrypts its encrypted values, reporting failures by key.
+func (l *Loader) resolveSecrets(cfg interface{}) error {
+	r := &secretResolver{providers: l.secretProviders(), key: l.encryptionKey}
+	r.walk(reflect.ValueOf(cfg), "", false)
+	if len(r.errs) > 0 {
+		return r.errs
+	}
+
+	return nil
+}
+
+// walk resolves the values of v, a field of key tagged as secret or not.
+func (r *secretResolver) walk(v reflect.Value, key string, secret bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() && isSection(v.Elem().Type()) {
+			r.walk(v.Elem(), key, false)
+		}
+	case reflect.Struct:
+		if !isSection(v.Type()) {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name, squash, ok := fieldKey(field)
+			if !ok {
+				continue
+			}
+			if squash {
+				r.walk(v.Field(i), key, false)
+				continue
+			}
+			r.walk(v.Field(i), joinKey(key, name), field.Tag.Get("secret") == "true")
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.walk(v.Index(i), fmt.Sprintf("%s[%d]", key, i), secret)
+		}
+	case reflect.String:
+		if value, ok := r.resolve(v.String(), key, secret); ok {
+			v.SetString(value)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			entryKey := joinKey(key, fmt.Sprint(iter.Key().Interface()))
+			if value, ok := r.resolve(iter.Value().String(), entryKey, secret); ok {
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(value).Convert(v.Type().Elem()))
+			}
+		}
+	}
+}
+
+func (r *secretResolver) resolve(ref, key string, secret bool) (string, bool) {
+	if IsEncrypted(ref) {
+		return r.decrypt(ref, key)
+	}
+	if !secret {
+		return "", false
+	}
+
+	scheme, _, found := strings.Cut(ref, "://")
+	if !found {
+		return "", false
+	}
+	provider, ok := r.providers[scheme]
+	if !ok {
+		return "", false
+	}
+
+	value, err := provider.Resolve(ref)
+	if err != nil {
+		r.errs = append(r.errs, ValidationError{Key: key, Message: fmt.Sprintf("resolve %s: %v", ref, err)})
+		return "", false
+	}
+
+	return value, true
+}
+
+func (r *secretResolver) decrypt(value, key string) (string, bool) {
+	encKey, err := r.key()
+	if err == nil {
+		value, err = Decrypt(encKey, value)
+	}
+	if err != nil {
+		r.errs = append(r.errs, ValidationError{Key: key, Message: err.Error()})
+		return "", false
+	}
+
+	return value, true
+}
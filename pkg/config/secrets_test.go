@@ -0,0 +1,65 @@
+package config
+
+import "testing"
+
+func TestResolveSecretsOnlyInSecretFields(t *testing.T) {
+	t.Setenv("TEST_SECRET", "hunter2")
+
+	cfg := Config{
+		Database: DatabaseConfig{
+			Postgres: &PostgresConfig{
+				Password: "env://TEST_SECRET",
+				Params:   map[string]string{"options": "env://TEST_SECRET"},
+			},
+			SQLite:   &SQLiteConfig{Path: "file:///var/lib/app.db"},
+			Replicas: []ReplicaConfig{{Address: "replica:5432", Password: "env://TEST_SECRET"}},
+		},
+	}
+	cfg.Redis.Password = "env://TEST_SECRET"
+
+	l := NewLoader(LoaderOptions{})
+	if err := l.resolveSecrets(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := map[string]string{
+		"database.postgres.password":    cfg.Database.Postgres.Password,
+		"database.replicas[0].password": cfg.Database.Replicas[0].Password,
+		"redis.password":                cfg.Redis.Password,
+	}
+	for key, value := range resolved {
+		if value != "hunter2" {
+			t.Errorf("%s = %q, want the secret", key, value)
+		}
+	}
+
+	kept := map[string][2]string{
+		"database.postgres.params.options": {cfg.Database.Postgres.Params["options"], "env://TEST_SECRET"},
+		"database.sqlite.path":             {cfg.Database.SQLite.Path, "file:///var/lib/app.db"},
+	}
+	for key, values := range kept {
+		if values[0] != values[1] {
+			t.Errorf("%s = %q, want it as written", key, values[0])
+		}
+	}
+}
+
+func TestResolveSecretsDecryptsEveryField(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := Encrypt(key, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{Database: DatabaseConfig{Postgres: &PostgresConfig{Username: encrypted}}}
+	l := NewLoader(LoaderOptions{EncryptionKey: key})
+	if err := l.resolveSecrets(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Database.Postgres.Username; got != "admin" {
+		t.Errorf("username = %q, want it decrypted", got)
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	// validateMu guards validate and ruleMessages: RegisterRule may be
+	// called while configs are validated, e.g. on reload.
+	validateMu sync.RWMutex
+	validate   = newValidator()
+
+	// ruleMessages maps a validation tag to the message reported for it.
+	// %s is replaced with the tag parameter.
+	ruleMessages = map[string]string{
+		"required":         "required",
+		"required_if":      "required when %s",
+		"required_with":    "required when %s is set",
+		"required_without": "required when %s is not set",
+		"min":              "must be at least %s",
+		"max":              "must be at most %s",
+		"gte":              "must be >= %s",
+		"lte":              "must be <= %s",
+		"oneof":            "must be one of [%s]",
+		"numeric":          "must be numeric",
+		"logtype":          "must be a known log type",
+	}
+)
+
+// ValidationError describes a single invalid configuration key.
+type ValidationError struct {
+	Key     string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// ValidationErrors aggregates every problem found while validating a config.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ve := range e {
+		msgs[i] = ve.Error()
+	}
+
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks cfg against the `validate` tags of its fields and the
+// custom rules registered with RegisterRule.
+func (cfg *Config) Validate() error {
+	return Validate(cfg)
+}
+
+// Validate checks any config struct, such as a service specific one
+// embedding Config, and reports all problems at once as ValidationErrors.
+// Keys are reported with their full path, e.g. "database.mysql.address".
+func Validate(cfg interface{}) error {
+	validateMu.RLock()
+	defer validateMu.RUnlock()
+
+	err := validate.Struct(cfg)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	result := make(ValidationErrors, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		result = append(result, ValidationError{
+			Key:     keyPath(fe.Namespace()),
+			Message: ruleMessage(fe.Tag(), fe.Param()),
+		})
+	}
+
+	return result
+}
+
+// RegisterRule adds a custom validation tag. message is reported for
+// failing keys, with %s replaced by the tag parameter.
+func RegisterRule(tag string, fn validator.Func, message string) error {
+	validateMu.Lock()
+	defer validateMu.Unlock()
+
+	if err := validate.RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	ruleMessages[tag] = message
+
+	return nil
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		if _, squash, _ := fieldKey(f); squash {
+			return squashedName
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	_ = v.RegisterValidation("logtype", func(fl validator.FieldLevel) bool {
+		switch LogType(fl.Field().Int()) {
+		case Zap, Logrus:
+			return true
+		}
+		return false
+	})
+
+	return v
+}
+
+// squashedName names the embedded sections in validator namespaces;
+// keyPath drops it as their keys are promoted to the parent.
+const squashedName = "~"
+
+// keyPath strips the root struct name and the embedded sections from a
+// validator namespace.
+func keyPath(namespace string) string {
+	parts := strings.Split(namespace, ".")
+	if len(parts) == 1 {
+		return namespace
+	}
+
+	key := make([]string, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		if part != squashedName {
+			key = append(key, part)
+		}
+	}
+
+	return strings.Join(key, ".")
+}
+
+// ruleMessage returns the message of tag. The caller holds validateMu.
+func ruleMessage(tag, param string) string {
+	msg, ok := ruleMessages[tag]
+	if !ok {
+		return "failed " + tag + " rule"
+	}
+	if strings.Contains(msg, "%s") {
+		return fmt.Sprintf(msg, param)
+	}
+
+	return msg
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestRegisterRuleWhileValidating(t *testing.T) {
+	type ruled struct {
+		Name string `mapstructure:"name" validate:"required"`
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			tag := fmt.Sprintf("test_rule_%d", i)
+			if err := RegisterRule(tag, func(validator.FieldLevel) bool { return true }, "must pass "+tag); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var errs ValidationErrors
+			if err := Validate(&ruled{}); !errors.As(err, &errs) || errs[0].Message != "required" {
+				t.Errorf("Validate = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// validConfig returns a Config passing Validate.
+func validConfig() *Config {
+	return &Config{
+		Database: DatabaseConfig{Driver: DriverSQLite, SQLite: &SQLiteConfig{Path: ":memory:"}},
+		HTTP:     HTTPConfig{Port: "8080"},
+		Redis:    RedisConfig{Addr: "localhost:6379"},
+		Logger:   LoggerConfig{LogLevel: "info"},
+		Server:   ServerConfig{Mode: "dev"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   ValidationErrors
+	}{
+		{
+			name:   "valid",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "nested struct",
+			modify: func(cfg *Config) {
+				cfg.Database = DatabaseConfig{Driver: DriverMySQL, MySQL: &MysqlConfig{Database: "app"}}
+			},
+			want: ValidationErrors{{Key: "database.mysql.address", Message: "required"}},
+		},
+		{
+			name: "map entry",
+			modify: func(cfg *Config) {
+				cfg.FeatureFlags = map[string]FeatureFlagConfig{"beta": {Percentage: 150}}
+			},
+			want: ValidationErrors{{Key: "featureFlags[beta].percentage", Message: "must be <= 100"}},
+		},
+		{
+			name: "conditional rule",
+			modify: func(cfg *Config) {
+				cfg.Redis = RedisConfig{Mode: "sentinel", Addrs: []string{"localhost:26379"}}
+			},
+			want: ValidationErrors{{Key: "redis.masterName", Message: "required when Mode sentinel"}},
+		},
+		{
+			name: "custom rule",
+			modify: func(cfg *Config) {
+				cfg.Logger.LogType = 42
+			},
+			want: ValidationErrors{{Key: "logger.logType", Message: "must be a known log type"}},
+		},
+		{
+			name: "every violation",
+			modify: func(cfg *Config) {
+				cfg.HTTP.Port = "http"
+				cfg.Logger.LogLevel = ""
+				cfg.Server.Mode = "staging"
+			},
+			want: ValidationErrors{
+				{Key: "http.port", Message: "must be numeric"},
+				{Key: "logger.level", Message: "required"},
+				{Key: "server.mode", Message: "must be one of [dev test prod]"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate = %v", err)
+				}
+				return
+			}
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Validate = %v, want ValidationErrors", err)
+			}
+			if !reflect.DeepEqual(errs, tt.want) {
+				t.Errorf("Validate = %v, want %v", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationErrorsMessage(t *testing.T) {
+	err := ValidationErrors{
+		{Key: "database.mysql.address", Message: "required"},
+		{Key: "http.port", Message: "must be numeric"},
+	}
+	if want := "invalid config: database.mysql.address: required; http.port: must be numeric"; err.Error() != want {
+		t.Errorf("Error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	type service struct {
+		Config `mapstructure:",squash"`
+		Region string `mapstructure:"region" validate:"test_region"`
+	}
+	err := RegisterRule("test_region", func(fl validator.FieldLevel) bool {
+		return strings.HasPrefix(fl.Field().String(), "eu-")
+	}, "must be an EU region")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := service{Config: *validConfig(), Region: "us-east-1"}
+	var errs ValidationErrors
+	if err := Validate(&cfg); !errors.As(err, &errs) {
+		t.Fatalf("Validate = %v, want ValidationErrors", err)
+	}
+	if want := (ValidationErrors{{Key: "region", Message: "must be an EU region"}}); !reflect.DeepEqual(errs, want) {
+		t.Errorf("Validate = %v, want %v", errs, want)
+	}
+
+	cfg.Region = "eu-west-1"
+	cfg.Logger.LogLevel = ""
+	errs = nil
+	if err := Validate(&cfg); !errors.As(err, &errs) {
+		t.Fatalf("Validate = %v, want ValidationErrors", err)
+	}
+	if want := (ValidationErrors{{Key: "logger.level", Message: "required"}}); !reflect.DeepEqual(errs, want) {
+		t.Errorf("Validate = %v, want %v", errs, want)
+	}
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of events editors and ConfigMap updates
+// produce for a single save into one reload.
+const reloadDebounce = 100 * time.Millisecond
+
+// configMapData is the symlink a Kubernetes ConfigMap mount swaps to
+// update all of its files at once.
+const configMapData = "..data"
+
+// Watcher keeps the configuration in sync with the files it was loaded from.
+// On every change the files are re-parsed and re-validated; if that fails
+// the last good Config is kept and the error is reported to OnError handlers.
+type Watcher struct {
+	// loadMu serializes reloads since a Loader is not safe for concurrent use.
+	loadMu sync.Mutex
+	loader *Loader
+
+	mu            sync.RWMutex
+	current       *Config
+	subscribers   map[Section][]func(cfg *Config)
+	errorHandlers []func(err error)
+	timer         *time.Timer
+	closed        bool
+	fsWatcher     *fsnotify.Watcher
+}
+
+// NewWatcher loads the configuration with loader. Call Start to begin
+// watching the files it was read from for changes.
+func NewWatcher(loader *Loader) (*Watcher, error) {
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		loader:      loader,
+		current:     cfg,
+		subscribers: make(map[Section][]func(cfg *Config)),
+	}, nil
+}
+
+// Config returns the last successfully loaded configuration.
+// The returned value must be treated as read-only.
+func (w *Watcher) Config() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.current
+}
+
+// Subscribe registers fn to be called with the new configuration
+// whenever the given section changes.
+func (w *Watcher) Subscribe(section Section, fn func(cfg *Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers[section] = append(w.subscribers[section], fn)
+}
+
+// OnError registers fn to be called when a reload is rejected.
+func (w *Watcher) OnError(fn func(err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.errorHandlers = append(w.errorHandlers, fn)
+}
+
+// Start watches the directories of the config files for changes. The
+// directories are watched rather than the files, so that files replaced
+// by editors or ConfigMap updates, and overlays created later such as
+// LocalOverlay, are picked up.
+func (w *Watcher) Start() error {
+	// Reloads write to the loader: read what to watch under loadMu.
+	w.loadMu.Lock()
+	watched := newWatchSet(w.loader)
+	w.loadMu.Unlock()
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, dir := range watched.dirs() {
+		if err := fsWatcher.Add(dir); err != nil {
+			_ = fsWatcher.Close()
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return fsWatcher.Close()
+	}
+	w.fsWatcher = fsWatcher
+	w.mu.Unlock()
+
+	go w.watch(fsWatcher, watched)
+
+	return nil
+}
+
+// Close stops delivering changes. Pending reloads are discarded.
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.fsWatcher != nil {
+		_ = w.fsWatcher.Close()
+		w.fsWatcher = nil
+	}
+}
+
+// watchSet is the set of files a configuration is read from: the
+// overlays of configDir, in any of the ConfigExts, and files.
+type watchSet struct {
+	configDir string
+	overlays  []string
+	files     []string
+}
+
+func newWatchSet(l *Loader) watchSet {
+	ws := watchSet{}
+	if l.opts.ConfigDir != "" {
+		ws.configDir = filepath.Clean(l.opts.ConfigDir)
+		for _, o := range l.overlays() {
+			ws.overlays = append(ws.overlays, o.name)
+		}
+	}
+	for _, file := range l.opts.Files {
+		ws.files = append(ws.files, filepath.Clean(file))
+	}
+
+	return ws
+}
+
+// dirs returns the directories holding the files.
+func (ws watchSet) dirs() []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	if ws.configDir != "" {
+		add(ws.configDir)
+	}
+	for _, file := range ws.files {
+		add(filepath.Dir(file))
+	}
+
+	return dirs
+}
+
+// contains reports whether a change to file may change the configuration.
+func (ws watchSet) contains(file string) bool {
+	file = filepath.Clean(file)
+	if ws.configDir != "" && filepath.Dir(file) == ws.configDir {
+		base := filepath.Base(file)
+		if base == configMapData {
+			return true
+		}
+		name, ext := strings.TrimSuffix(base, filepath.Ext(base)), strings.TrimPrefix(filepath.Ext(base), ".")
+		for _, overlay := range ws.overlays {
+			if name != overlay {
+				continue
+			}
+			for _, configExt := range ConfigExts {
+				if ext == configExt {
+					return true
+				}
+			}
+		}
+	}
+	for _, f := range ws.files {
+		if file == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *Watcher) watch(fsWatcher *fsnotify.Watcher, watched watchSet) {
+	for {
+		select {
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op != fsnotify.Chmod && watched.contains(event.Name) {
+				w.scheduleReload()
+			}
+		case _, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped, such as on a queue overflow.
+			w.scheduleReload()
+		}
+	}
+}
+
+func (w *Watcher) scheduleReload() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(reloadDebounce, w.reload)
+}
+
+func (w *Watcher) reload() {
+	w.loadMu.Lock()
+	defer w.loadMu.Unlock()
+
+	cfg, err := w.loader.Load()
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	if err != nil {
+		handlers := w.errorHandlers
+		w.mu.Unlock()
+		for _, fn := range handlers {
+			fn(err)
+		}
+		return
+	}
+
+	old := w.current
+	w.current = cfg
+	var notify []func(cfg *Config)
+	for _, section := range Sections {
+		if !reflect.DeepEqual(old.Section(section), cfg.Section(section)) {
+			notify = append(notify, w.subscribers[section]...)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, fn := range notify {
+		fn(cfg)
+	}
+}
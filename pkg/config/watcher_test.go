@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// watcherBase is a valid base config, with the logger level left to fill.
+const watcherBase = `server:
+  mode: dev
+logger:
+  level: %s
+database:
+  driver: sqlite
+  sqlite:
+    path: ":memory:"
+redis:
+  addr: localhost:6379
+`
+
+func startWatcher(t *testing.T, dir string) (*Watcher, <-chan string) {
+	t.Helper()
+	w, err := NewWatcher(NewLoader(LoaderOptions{ConfigDir: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := make(chan string, 10)
+	w.Subscribe(SectionLogger, func(cfg *Config) { levels <- cfg.Logger.LogLevel })
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Close)
+
+	return w, levels
+}
+
+func waitLevel(t *testing.T, levels <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-levels:
+		if got != want {
+			t.Errorf("level = %s, want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reload to level %s", want)
+	}
+}
+
+func TestWatcherPicksUpNewOverlay(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "info"))
+	_, levels := startWatcher(t, dir)
+
+	writeConfig(t, dir, "local.yml", "logger:\n  level: debug\n")
+	waitLevel(t, levels, "debug")
+
+	if err := os.Remove(filepath.Join(dir, "local.yml")); err != nil {
+		t.Fatal(err)
+	}
+	waitLevel(t, levels, "info")
+}
+
+func TestWatcherFollowsReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "info"))
+	_, levels := startWatcher(t, dir)
+
+	// Editors and ConfigMap updates write a new file and rename it.
+	writeConfig(t, dir, "base.yml.tmp", fmt.Sprintf(watcherBase, "warn"))
+	if err := os.Rename(filepath.Join(dir, "base.yml.tmp"), filepath.Join(dir, "base.yml")); err != nil {
+		t.Fatal(err)
+	}
+	waitLevel(t, levels, "warn")
+
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "error"))
+	waitLevel(t, levels, "error")
+}
+
+func TestWatcherClose(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "info"))
+	w, levels := startWatcher(t, dir)
+
+	w.Close()
+	w.Close()
+	writeConfig(t, dir, "local.yml", "logger:\n  level: debug\n")
+	select {
+	case level := <-levels:
+		t.Errorf("reloaded to %s after Close", level)
+	case <-time.After(5 * reloadDebounce):
+	}
+}
+
+func TestWatcherKeepsLastGoodConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "info"))
+	w, levels := startWatcher(t, dir)
+	errs := make(chan error, 10)
+	w.OnError(func(err error) { errs <- err })
+
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "verbose"))
+	select {
+	case err := <-errs:
+		var verrs ValidationErrors
+		if !errors.As(err, &verrs) || verrs[0].Key != "logger.level" {
+			t.Errorf("reload error = %v, want logger.level rejected", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalid edit not reported")
+	}
+	select {
+	case level := <-levels:
+		t.Errorf("subscriber notified of the invalid level %s", level)
+	default:
+	}
+	if got := w.Config().Logger.LogLevel; got != "info" {
+		t.Errorf("level = %s, want the last good one", got)
+	}
+
+	// A fixed edit is applied again.
+	writeConfig(t, dir, "base.yml", fmt.Sprintf(watcherBase, "debug"))
+	waitLevel(t, levels, "debug")
+}
@@ -0,0 +1,65 @@
+package config
+
+import "time"
+
+const (
+	defaultWorkerConcurrency      = 10
+	defaultWorkerBlock            = 2 * time.Second
+	defaultWorkerMinIdle          = time.Minute
+	defaultWorkerClaimInterval    = 30 * time.Second
+	defaultWorkerMaxDeliveries    = 5
+	defaultWorkerDeadLetterSuffix = ":dead"
+	defaultWorkerDrainTimeout     = 30 * time.Second
+)
+
+// WorkerConfig configures the consumers of Redis Streams run by a
+// service, as the consumer Consumer of the group Group, the hostname and
+// pid when empty. At most Concurrency messages are handled at once, and
+// reads wait up to Block for new messages.
+//
+// Messages whose handler failed, or whose consumer died, are claimed once
+// pending for MinIdle, checked every ClaimInterval. After MaxDeliveries
+// deliveries, they are moved to the stream of the same name followed by
+// DeadLetterSuffix. On shutdown, the messages being handled are given
+// DrainTimeout to complete.
+type WorkerConfig struct {
+	Enabled     bool          `yaml:"enabled" mapstructure:"enabled"`
+	Group       string        `yaml:"group" mapstructure:"group" validate:"required_if=Enabled true"`
+	Consumer    string        `yaml:"consumer" mapstructure:"consumer"`
+	Concurrency int           `yaml:"concurrency" mapstructure:"concurrency" validate:"gte=0"`
+	Block       time.Duration `yaml:"block" mapstructure:"block" validate:"gte=0"`
+
+	MinIdle          time.Duration `yaml:"minIdle" mapstructure:"minIdle" validate:"gte=0"`
+	ClaimInterval    time.Duration `yaml:"claimInterval" mapstructure:"claimInterval" validate:"gte=0"`
+	MaxDeliveries    int64         `yaml:"maxDeliveries" mapstructure:"maxDeliveries" validate:"gte=0"`
+	DeadLetterSuffix string        `yaml:"deadLetterSuffix" mapstructure:"deadLetterSuffix"`
+	DrainTimeout     time.Duration `yaml:"drainTimeout" mapstructure:"drainTimeout" validate:"gte=0"`
+}
+
+// WithDefaults returns w with the zero fields set to the loader defaults,
+// for configs built without a Loader.
+func (w WorkerConfig) WithDefaults() WorkerConfig {
+	if w.Concurrency == 0 {
+		w.Concurrency = defaultWorkerConcurrency
+	}
+	if w.Block == 0 {
+		w.Block = defaultWorkerBlock
+	}
+	if w.MinIdle == 0 {
+		w.MinIdle = defaultWorkerMinIdle
+	}
+	if w.ClaimInterval == 0 {
+		w.ClaimInterval = defaultWorkerClaimInterval
+	}
+	if w.MaxDeliveries == 0 {
+		w.MaxDeliveries = defaultWorkerMaxDeliveries
+	}
+	if w.DeadLetterSuffix == "" {
+		w.DeadLetterSuffix = defaultWorkerDeadLetterSuffix
+	}
+	if w.DrainTimeout == 0 {
+		w.DrainTimeout = defaultWorkerDrainTimeout
+	}
+
+	return w
+}
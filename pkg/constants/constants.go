@@ -4,13 +4,13 @@ import "time"
 
 const (
 	GrpcPort   = "GRPC_PORT"
-	HttpPort   = "HTTP_PORT"
 	ConfigPath = "CONFIG_PATH"
 	JaegerHost = "JAEGER_HOST"
 	JaegerPort = "JAEGER_PORT"
-	RedisAddr  = "REDIS_ADDR"
 	Yaml       = "yaml"
+	Yml        = "yml"
 	Json       = "json"
+	Toml       = "toml"
 
 	GRPC     = "GRPC"
 	METHOD   = "METHOD"
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// Driver opens the databases of one DatabaseConfig driver.
+type Driver struct {
+	// SQLDriver is the database/sql driver name, e.g. "mysql".
+	SQLDriver string
+	// DSN returns the data source name of the database cfg selects.
+	DSN func(cfg *config.DatabaseConfig) (string, error)
+	// Dialector returns the gorm dialector using pool.
+	Dialector func(pool *sql.DB) gorm.Dialector
+	// Tune, when set, adjusts the pool opened for cfg after the pool
+	// settings of cfg are applied.
+	Tune func(cfg *config.DatabaseConfig, pool *sql.DB)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{
+		config.DriverMySQL:    mysqlDriver,
+		config.DriverPostgres: postgresDriver,
+		config.DriverSQLite:   sqliteDriver,
+	}
+)
+
+// RegisterDriver adds or replaces the driver selected by name in DatabaseConfig.Driver.
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	drivers[name] = driver
+}
+
+func lookupDriver(name string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[name]
+	if !ok {
+		return Driver{}, fmt.Errorf("unknown database driver %q", name)
+	}
+
+	return driver, nil
+}
+
+// Connect opens a connection pool to the database of cfg and checks it
+// with a ping, retrying as configured by cfg.Retry until ctx is done.
+// When cfg lists replicas, the returned DB sends the reads outside
+// transactions to them and everything else to the primary; close it
+// with Close. Its SQL logs go to logger, as configured by cfg.Log.
+func Connect(ctx context.Context, cfg *config.DatabaseConfig, logger logger.Logger) (*gorm.DB, error) {
+	driver, err := lookupDriver(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// Settings errors are not worth a retry: check them first.
+	primary, err := newTarget(driver, cfg)
+	if err != nil {
+		return nil, err
+	}
+	replicas := make([]target, 0, len(cfg.Replicas))
+	for _, replica := range cfg.Replicas {
+		replicaCfg, err := cfg.Replica(replica)
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTarget(driver, replicaCfg)
+		if err != nil {
+			return nil, fmt.Errorf("replica %s: %w", replica.Address, err)
+		}
+		replicas = append(replicas, t)
+	}
+
+	sqlLogger := NewGormLogger(logger, cfg.Log)
+	var db *gorm.DB
+	err = Retry(ctx, cfg.Retry, logger, cfg.Driver, func(ctx context.Context) error {
+		var err error
+		db, err = open(ctx, driver, sqlLogger, primary, replicas)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// target is a database to open with its data source name.
+type target struct {
+	cfg *config.DatabaseConfig
+	dsn string
+}
+
+func newTarget(driver Driver, cfg *config.DatabaseConfig) (target, error) {
+	dsn, err := driver.DSN(cfg)
+	if err != nil {
+		return target{}, err
+	}
+
+	return target{cfg: cfg, dsn: dsn}, nil
+}
+
+func open(ctx context.Context, driver Driver, sqlLogger *GormLogger, primary target, replicas []target) (*gorm.DB, error) {
+	pool, err := openPool(ctx, driver, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(driver.Dialector(pool), &gorm.Config{Logger: sqlLogger})
+	if err != nil {
+		_ = pool.Close()
+		return nil, fmt.Errorf("open %s: %w", primary.cfg.Driver, err)
+	}
+
+	if len(replicas) > 0 {
+		if err := useReplicas(ctx, db, driver, primary.cfg, replicas); err != nil {
+			_ = pool.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// openPool opens the database/sql pool of t and pings it.
+func openPool(ctx context.Context, driver Driver, t target) (*sql.DB, error) {
+	pool, err := sql.Open(driver.SQLDriver, t.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", t.cfg.Driver, err)
+	}
+	if err := pool.PingContext(ctx); err != nil {
+		_ = pool.Close()
+		return nil, fmt.Errorf("ping %s: %w", t.cfg.Driver, err)
+	}
+
+	setPool(pool, t.cfg.Pool)
+	if driver.Tune != nil {
+		driver.Tune(t.cfg, pool)
+	}
+
+	return pool, nil
+}
+
+func setPool(pool *sql.DB, cfg config.PoolConfig) {
+	cfg = cfg.WithDefaults()
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
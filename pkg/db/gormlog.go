@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+var sqlLogLevels = map[string]gormlogger.LogLevel{
+	config.SQLLogSilent: gormlogger.Silent,
+	config.SQLLogError:  gormlogger.Error,
+	config.SQLLogWarn:   gormlogger.Warn,
+	config.SQLLogInfo:   gormlogger.Info,
+}
+
+// GormLogger writes the logs of gorm to a logger.Logger: failed queries
+// as errors, slow queries as warnings and, at the info level, every
+// query, with the fields sql, rows, duration in milliseconds, the caller
+// and the request and trace ids of the query context.
+//
+// Unless cfg.Params is set, the logged SQL has placeholders instead of
+// the query parameters. gorm.ErrRecordNotFound is not logged as a
+// failure, as it is an expected outcome of a lookup.
+type GormLogger struct {
+	logger logger.Logger
+	cfg    config.SQLLogConfig
+	level  gormlogger.LogLevel
+}
+
+var (
+	_ gormlogger.Interface = (*GormLogger)(nil)
+	_ gorm.ParamsFilter    = (*GormLogger)(nil)
+)
+
+func NewGormLogger(logger logger.Logger, cfg config.SQLLogConfig) *GormLogger {
+	cfg = cfg.WithDefaults()
+	level, ok := sqlLogLevels[cfg.Level]
+	if !ok {
+		level = gormlogger.Warn
+	}
+
+	return &GormLogger{logger: logger, cfg: cfg, level: level}
+}
+
+// LogMode returns a copy of l logging at level.
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.logger.Infow(fmt.Sprintf(msg, args...), l.fields(ctx))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.logger.Warnw(fmt.Sprintf(msg, args...), l.fields(ctx))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.logger.Errorw(fmt.Sprintf(msg, args...), l.fields(ctx))
+	}
+}
+
+// Trace logs the query run since begin, as returned by fc, according to
+// its outcome and duration.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.cfg.SlowThreshold > 0 && elapsed > l.cfg.SlowThreshold
+	switch {
+	case failed && l.level >= gormlogger.Error:
+		fields := l.queryFields(ctx, elapsed, fc)
+		fields["error"] = err.Error()
+		l.logger.Errorw("sql query failed", fields)
+	case slow && l.level >= gormlogger.Warn:
+		fields := l.queryFields(ctx, elapsed, fc)
+		fields["slowThreshold"] = l.cfg.SlowThreshold.String()
+		l.logger.Warnw("slow sql query", fields)
+	case l.level >= gormlogger.Info:
+		l.logger.Infow("sql query", l.queryFields(ctx, elapsed, fc))
+	}
+}
+
+// ParamsFilter drops the query parameters from the SQL passed to Trace,
+// unless the config logs them.
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.cfg.Params {
+		return sql, params
+	}
+
+	return sql, nil
+}
+
+func (l *GormLogger) fields(ctx context.Context) logger.Fields {
+	fields := logger.ContextFields(ctx)
+	fields["caller"] = caller()
+	return fields
+}
+
+func (l *GormLogger) queryFields(ctx context.Context, elapsed time.Duration, fc func() (string, int64)) logger.Fields {
+	sql, rows := fc()
+	fields := l.fields(ctx)
+	fields["sql"] = sql
+	fields["rows"] = rows
+	fields["duration"] = float64(elapsed.Nanoseconds()) / 1e6
+
+	return fields
+}
+
+// callerSkipPrefixes start the functions of the database layers between
+// a query and the code running it, besides gorm, its drivers and plugins.
+var callerSkipPrefixes = func() []string {
+	pkg := path.Dir(reflect.TypeOf(GormLogger{}).PkgPath())
+	return []string{pkg + "/db.", pkg + "/repository."}
+}()
+
+// caller returns the file and line of the code running the query.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !skipCaller(frame) {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func skipCaller(frame runtime.Frame) bool {
+	if strings.HasPrefix(frame.Function, "gorm.io/") {
+		return true
+	}
+	for _, prefix := range callerSkipPrefixes {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields logger.Fields
+}
+
+// captureLogger records the structured logs of a GormLogger. The other
+// methods of logger.Logger are not used by it.
+type captureLogger struct {
+	logger.Logger
+
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *captureLogger) Infow(msg string, fields logger.Fields)  { l.add("info", msg, fields) }
+func (l *captureLogger) Warnw(msg string, fields logger.Fields)  { l.add("warn", msg, fields) }
+func (l *captureLogger) Errorw(msg string, fields logger.Fields) { l.add("error", msg, fields) }
+
+func (l *captureLogger) add(level, msg string, fields logger.Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+// queryLog returns the log of the first query whose SQL contains sql.
+func (l *captureLogger) queryLog(t *testing.T, sql string) logEntry {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, entry := range l.entries {
+		if s, _ := entry.fields["sql"].(string); strings.Contains(s, sql) {
+			return entry
+		}
+	}
+	t.Fatalf("no log of %q in %v", sql, l.entries)
+	return logEntry{}
+}
+
+// openLoggedDB returns the test database logging to a captureLogger
+// configured with cfg.
+func openLoggedDB(t *testing.T, cfg config.SQLLogConfig) (*gorm.DB, *captureLogger) {
+	t.Helper()
+	capture := &captureLogger{}
+
+	return openTestDB(t).Session(&gorm.Session{Logger: NewGormLogger(capture, cfg)}), capture
+}
+
+func TestGormLoggerParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params bool
+		want   string
+	}{
+		{name: "redacted", want: "WHERE name = ?"},
+		{name: "logged", params: true, want: `WHERE name = "s3cret"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, capture := openLoggedDB(t, config.SQLLogConfig{Level: config.SQLLogInfo, Params: tt.params})
+
+			var items []txItem
+			if err := db.Where("name = ?", "s3cret").Find(&items).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			entry := capture.queryLog(t, "WHERE name")
+			sql := entry.fields["sql"].(string)
+			if !strings.Contains(sql, tt.want) {
+				t.Errorf("logged %q, want %q", sql, tt.want)
+			}
+			if !tt.params && strings.Contains(sql, "s3cret") {
+				t.Errorf("logged the parameter: %q", sql)
+			}
+		})
+	}
+}
+
+func TestGormLoggerLevels(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.SQLLogConfig
+		query func(db *gorm.DB) error
+		level string
+		msg   string
+	}{
+		{
+			name:  "fast query",
+			cfg:   config.SQLLogConfig{Level: config.SQLLogInfo, SlowThreshold: time.Hour},
+			query: func(db *gorm.DB) error { return db.Find(&[]txItem{}).Error },
+			level: "info",
+			msg:   "sql query",
+		},
+		{
+			name:  "slow query",
+			cfg:   config.SQLLogConfig{Level: config.SQLLogInfo, SlowThreshold: time.Nanosecond},
+			query: func(db *gorm.DB) error { return db.Find(&[]txItem{}).Error },
+			level: "warn",
+			msg:   "slow sql query",
+		},
+		{
+			name:  "failed query",
+			cfg:   config.SQLLogConfig{Level: config.SQLLogInfo, SlowThreshold: time.Nanosecond},
+			query: func(db *gorm.DB) error { return db.Table("missing").Find(&[]txItem{}).Error },
+			level: "error",
+			msg:   "sql query failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, capture := openLoggedDB(t, tt.cfg)
+			_ = tt.query(db)
+
+			entry := capture.queryLog(t, "SELECT")
+			if entry.level != tt.level || entry.msg != tt.msg {
+				t.Errorf("logged %s %q, want %s %q", entry.level, entry.msg, tt.level, tt.msg)
+			}
+		})
+	}
+}
+
+func TestGormLoggerQuiet(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.SQLLogConfig
+		query func(db *gorm.DB) error
+	}{
+		{
+			name:  "fast query at warn",
+			cfg:   config.SQLLogConfig{Level: config.SQLLogWarn, SlowThreshold: time.Hour},
+			query: func(db *gorm.DB) error { return db.Find(&[]txItem{}).Error },
+		},
+		{
+			name:  "record not found",
+			cfg:   config.SQLLogConfig{Level: config.SQLLogWarn},
+			query: func(db *gorm.DB) error { return db.First(&txItem{}).Error },
+		},
+		{
+			name:  "failed query when silent",
+			cfg:   config.SQLLogConfig{Level: config.SQLLogSilent},
+			query: func(db *gorm.DB) error { return db.Table("missing").Find(&[]txItem{}).Error },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, capture := openLoggedDB(t, tt.cfg)
+			_ = tt.query(db)
+
+			if len(capture.entries) != 0 {
+				t.Errorf("logged %v", capture.entries)
+			}
+		})
+	}
+}
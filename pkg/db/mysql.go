@@ -1,38 +1,43 @@
 package db
 
 import (
-	"time"
+	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
-	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-const (
-	maxDBIdleConns  = 10
-	maxDBOpenConns  = 100
-	maxConnLifeTime = 30 * time.Minute
-)
+var mysqlDriver = Driver{
+	SQLDriver: "mysql",
+	DSN:       mysqlDSN,
+	Dialector: func(pool *sql.DB) gorm.Dialector {
+		return mysql.New(mysql.Config{Conn: pool})
+	},
+}
 
-func ConnectMySQL(cfg *config.MysqlConfig, logger logger.Logger) *gorm.DB {
-	db, err := gorm.Open(mysql.Open(cfg.FormatDSN()), &gorm.Config{})
-	if err != nil {
-		logger.Fatalf("Error open mysql: %v", err)
+// mysqlDSN formats the DSN of cfg.MySQL. With TLS enabled, the TLS
+// settings are registered with the driver under a name of their own.
+func mysqlDSN(cfg *config.DatabaseConfig) (string, error) {
+	if cfg.MySQL == nil {
+		return "", errors.New("database.mysql is not set")
 	}
 
-	err = db.Raw("SELECT 1").Error
-	if err != nil {
-		logger.Fatalf("Error querying SELECT 1", err)
+	m := *cfg.MySQL
+	if m.TLS.Enabled {
+		tlsConfig, err := NewTLSConfig(&m.TLS)
+		if err != nil {
+			return "", fmt.Errorf("mysql tls: %w", err)
+		}
+		m.TLSConfig = "db-" + m.Address
+		if err := mysqldriver.RegisterTLSConfig(m.TLSConfig, tlsConfig); err != nil {
+			return "", fmt.Errorf("mysql tls: %w", err)
+		}
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		logger.Fatalf("Error get sql DB", err)
-	}
-	sqlDB.SetMaxIdleConns(maxDBIdleConns)
-	sqlDB.SetMaxOpenConns(maxDBOpenConns)
-	sqlDB.SetConnMaxLifetime(maxConnLifeTime)
-	return db
+	return m.FormatDSN(), nil
 }
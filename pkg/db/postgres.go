@@ -0,0 +1,27 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+
+	// registers the "pgx" database/sql driver
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var postgresDriver = Driver{
+	SQLDriver: "pgx",
+	DSN: func(cfg *config.DatabaseConfig) (string, error) {
+		if cfg.Postgres == nil {
+			return "", errors.New("database.postgres is not set")
+		}
+
+		return cfg.Postgres.FormatDSN(), nil
+	},
+	Dialector: func(pool *sql.DB) gorm.Dialector {
+		return postgres.New(postgres.Config{Conn: pool})
+	},
+}
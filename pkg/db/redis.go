@@ -1,25 +1,77 @@
 package db
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/go-redis/redis/v8"
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
-
-	"log"
-	"time"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
 )
 
-func ConnectRedis(cfgRedis *config.RedisConfig) *redis.Client {
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:         cfgRedis.Addr,
-		DB:           cfgRedis.DB,
-		PoolSize:     cfgRedis.PoolSize,
-		PoolTimeout:  time.Duration(cfgRedis.PoolTimeout) * time.Second,
-		MinIdleConns: cfgRedis.MinIdleConns,
-	})
+// ConnectRedis creates a client for the standalone server, Sentinel group
+// or Cluster of cfg and checks it with a ping, retrying as configured by
+// cfg.Retry until ctx is done.
+func ConnectRedis(ctx context.Context, cfg *config.RedisConfig, logger logger.Logger) (redis.UniversalClient, error) {
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := redisClient.Ping(redisClient.Context()).Result()
+	err = Retry(ctx, cfg.Retry, logger, "redis", func(ctx context.Context) error {
+		if err := client.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("ping redis: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal("Error pinging redis", err)
+		_ = client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func newRedisClient(cfg *config.RedisConfig) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		DB:               cfg.DB,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		MasterName:       cfg.MasterName,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		PoolTimeout:      cfg.PoolTimeout,
+	}
+	// Addr names the standalone server; the other modes only fall back
+	// to it as their single seed, so an overlay can switch modes without
+	// clearing it.
+	standalone := cfg.Mode == config.RedisStandalone || cfg.Mode == ""
+	if cfg.Addr != "" && (standalone || len(cfg.Addrs) == 0) {
+		opts.Addrs = []string{cfg.Addr}
+	}
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := NewTLSConfig(&cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("redis tls: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	switch cfg.Mode {
+	case config.RedisSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case config.RedisCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	case config.RedisStandalone, "":
+		return redis.NewClient(opts.Simple()), nil
 	}
-	return redisClient
+
+	return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
 }
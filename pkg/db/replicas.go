@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const replicationName = "db:replication"
+
+// replication keeps the replica pools of a DB and sends the reads
+// following a write in the same context to the primary.
+type replication struct {
+	pools  []*sql.DB
+	window time.Duration
+}
+
+func (r *replication) Name() string {
+	return replicationName
+}
+
+func (r *replication) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().After("gorm:raw").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("db:read_your_writes", r.readYourWrites); err != nil {
+		return err
+	}
+
+	return callbacks.Row().Before("gorm:row").Register("db:read_your_writes", r.readYourWrites)
+}
+
+func (r *replication) markWrite(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	if w, ok := db.Statement.Context.Value(writesKey{}).(*writes); ok {
+		atomic.StoreInt64(&w.last, time.Now().UnixNano())
+	}
+}
+
+func (r *replication) readYourWrites(db *gorm.DB) {
+	if r.window <= 0 {
+		return
+	}
+	w, ok := db.Statement.Context.Value(writesKey{}).(*writes)
+	if !ok {
+		return
+	}
+	if last := atomic.LoadInt64(&w.last); last != 0 && time.Since(time.Unix(0, last)) < r.window {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
+
+type writesKey struct{}
+
+// writes records the time of the last write made with a context.
+type writes struct {
+	last int64
+}
+
+// WithReadYourWrites returns a context whose reads go to the primary for
+// the ReadYourWritesWindow following a write made with it, or with a
+// context derived from it, so they see that write despite replica lag.
+// Call it once per request.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(writesKey{}).(*writes); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, writesKey{}, &writes{})
+}
+
+// roundRobin is a dbresolver.Policy using the replicas in turn.
+type roundRobin struct {
+	next uint64
+}
+
+func (p *roundRobin) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	return pools[(atomic.AddUint64(&p.next, 1)-1)%uint64(len(pools))]
+}
+
+func readPolicy(name string) (dbresolver.Policy, error) {
+	switch name {
+	case config.ReadRandom, "":
+		return dbresolver.RandomPolicy{}, nil
+	case config.ReadRoundRobin:
+		return &roundRobin{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown read policy %q", name)
+}
+
+// useReplicas opens the replicas and routes the reads of db to them.
+func useReplicas(ctx context.Context, db *gorm.DB, driver Driver, cfg *config.DatabaseConfig, replicas []target) error {
+	policy, err := readPolicy(cfg.ReadPolicy)
+	if err != nil {
+		return err
+	}
+
+	r := &replication{window: cfg.ReadYourWritesWindow}
+	dialectors := make([]gorm.Dialector, 0, len(replicas))
+	for i, replica := range replicas {
+		pool, err := openPool(ctx, driver, replica)
+		if err != nil {
+			closePools(r.pools)
+			return fmt.Errorf("replica %s: %w", cfg.Replicas[i].Address, err)
+		}
+		r.pools = append(r.pools, pool)
+		dialectors = append(dialectors, driver.Dialector(pool))
+	}
+
+	// The resolver must be registered first: it opens the replicas with
+	// the plugins of db, which would initialize replication on them too.
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: policy})); err != nil {
+		closePools(r.pools)
+		return err
+	}
+	if err := db.Use(r); err != nil {
+		closePools(r.pools)
+		return err
+	}
+
+	return nil
+}
+
+// ReplicaPools returns the connection pools of the replicas db reads from.
+func ReplicaPools(db *gorm.DB) []*sql.DB {
+	if r, ok := db.Config.Plugins[replicationName].(*replication); ok {
+		return r.pools
+	}
+
+	return nil
+}
+
+// Close closes the connection pools of the primary and the replicas of db.
+func Close(db *gorm.DB) error {
+	closePools(ReplicaPools(db))
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+func closePools(pools []*sql.DB) {
+	for _, pool := range pools {
+		_ = pool.Close()
+	}
+}
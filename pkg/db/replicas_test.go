@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// openReplicatedDB returns a database reading from a replica, a
+// separate SQLite file whose txItem table holds only a "replica" row,
+// with the read-your-writes window.
+func openReplicatedDB(t *testing.T, window time.Duration) *gorm.DB {
+	t.Helper()
+	replica, err := gorm.Open(sqlite.Open(t.TempDir()+"/replica.db"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.AutoMigrate(&txItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Create(&txItem{Name: "replica"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	replicaDB, err := replica.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = replicaDB.Close() })
+
+	db := openTestDB(t)
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{sqlite.Dialector{Conn: replicaDB}}})
+	if err := db.Use(resolver); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(&replication{window: window}); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// readFrom returns "primary" or "replica", the database read with ctx.
+func readFrom(t *testing.T, db *gorm.DB, ctx context.Context) string {
+	t.Helper()
+	var replica int64
+	if err := db.WithContext(ctx).Model(&txItem{}).Where("name = ?", "replica").Count(&replica).Error; err != nil {
+		t.Fatal(err)
+	}
+	if replica == 1 {
+		return "replica"
+	}
+
+	return "primary"
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db := openReplicatedDB(t, time.Hour)
+	ctx := WithReadYourWrites(context.Background())
+
+	if got := readFrom(t, db, ctx); got != "replica" {
+		t.Fatalf("read before any write from the %s", got)
+	}
+	if err := db.WithContext(ctx).Create(&txItem{Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "same context", ctx: ctx, want: "primary"},
+		{name: "derived context", ctx: context.WithValue(ctx, struct{}{}, "derived"), want: "primary"},
+		{name: "wrapped again", ctx: WithReadYourWrites(ctx), want: "primary"},
+		{name: "other request", ctx: WithReadYourWrites(context.Background()), want: "replica"},
+		{name: "no tracking", ctx: context.Background(), want: "replica"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readFrom(t, db, tt.ctx); got != tt.want {
+				t.Errorf("read from the %s, want the %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadYourWritesWindow(t *testing.T) {
+	db := openReplicatedDB(t, 50*time.Millisecond)
+	ctx := WithReadYourWrites(context.Background())
+	if err := db.WithContext(ctx).Create(&txItem{Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := readFrom(t, db, ctx); got != "primary" {
+		t.Fatalf("read right after the write from the %s", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := readFrom(t, db, ctx); got != "replica" {
+		t.Errorf("read after the window from the %s", got)
+	}
+}
+
+func TestReadYourWritesDisabled(t *testing.T) {
+	db := openReplicatedDB(t, 0)
+	ctx := WithReadYourWrites(context.Background())
+	if err := db.WithContext(ctx).Create(&txItem{Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := readFrom(t, db, ctx); got != "replica" {
+		t.Errorf("read with no window from the %s", got)
+	}
+}
+
+func TestFailedWriteDoesNotStick(t *testing.T) {
+	db := openReplicatedDB(t, time.Hour)
+	ctx := WithReadYourWrites(context.Background())
+	if err := db.WithContext(ctx).Table("missing").Create(&txItem{Name: "lost"}).Error; err == nil {
+		t.Fatal("write to a missing table succeeded")
+	}
+	if got := readFrom(t, db, ctx); got != "replica" {
+		t.Errorf("read after a failed write from the %s", got)
+	}
+}
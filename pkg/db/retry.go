@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+// Retry calls connect until it succeeds, the attempts of cfg are
+// exhausted or ctx is done, waiting with exponential backoff and jitter
+// between attempts. Every failed attempt is logged. It returns the last
+// connect error, or the context error if ctx ended first.
+func Retry(ctx context.Context, cfg config.RetryConfig, logger logger.Logger, name string, connect func(ctx context.Context) error) error {
+	cfg = cfg.WithDefaults()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = connect(ctx); err == nil {
+			if attempt > 1 {
+				logger.Infof("%s connected after %d attempts", name, attempt)
+			}
+			return nil
+		}
+		if attempt >= cfg.MaxAttempts {
+			logger.Errorf("%s connect attempt %d/%d failed, giving up: %v", name, attempt, cfg.MaxAttempts, err)
+			return err
+		}
+
+		wait := Backoff(cfg, attempt)
+		logger.Warnf("%s connect attempt %d/%d failed, retrying in %s: %v", name, attempt, cfg.MaxAttempts, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the wait of cfg after the given failed attempt, from 1.
+func Backoff(cfg config.RetryConfig, attempt int) time.Duration {
+	wait := float64(cfg.InitialInterval) * math.Pow(cfg.Multiplier, float64(attempt-1))
+	if max := float64(cfg.MaxInterval); wait > max {
+		wait = max
+	}
+	if cfg.Jitter > 0 {
+		wait += wait * cfg.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(wait)
+}
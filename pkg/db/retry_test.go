@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+)
+
+func TestBackoff(t *testing.T) {
+	cfg := config.RetryConfig{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+		{attempt: 50, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := Backoff(cfg, tt.attempt); got != tt.want {
+			t.Errorf("Backoff after attempt %d = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	cfg := config.RetryConfig{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2, Jitter: 0.5}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 150 * time.Millisecond},
+		{attempt: 10, min: 500 * time.Millisecond, max: 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		varied := false
+		first := Backoff(cfg, tt.attempt)
+		for i := 0; i < 100; i++ {
+			got := Backoff(cfg, tt.attempt)
+			if got < tt.min || got > tt.max {
+				t.Fatalf("Backoff after attempt %d = %s, want within [%s, %s]", tt.attempt, got, tt.min, tt.max)
+			}
+			varied = varied || got != first
+		}
+		if !varied {
+			t.Errorf("Backoff after attempt %d is always %s", tt.attempt, first)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	log := zap.NewZapLogger(&config.LoggerConfig{LogLevel: "fatal"}, &config.ServerConfig{})
+	cfg := config.RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name     string
+		failures int
+		want     error
+		attempts int
+	}{
+		{name: "first attempt", failures: 0, attempts: 1},
+		{name: "after failures", failures: 2, attempts: 3},
+		{name: "attempts exhausted", failures: 5, want: errDown, attempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := Retry(context.Background(), cfg, log, "test", func(ctx context.Context) error {
+				attempts++
+				if attempts <= tt.failures {
+					return errDown
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.want) || attempts != tt.attempts {
+				t.Errorf("Retry = %v after %d attempts, want %v after %d", err, attempts, tt.want, tt.attempts)
+			}
+		})
+	}
+
+	t.Run("context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		attempts := 0
+		err := Retry(ctx, config.RetryConfig{MaxAttempts: 3, InitialInterval: time.Hour}, log, "test", func(ctx context.Context) error {
+			attempts++
+			cancel()
+			return errDown
+		})
+		if !errors.Is(err, context.Canceled) || attempts != 1 {
+			t.Errorf("Retry = %v after %d attempts, want context.Canceled after 1", err, attempts)
+		}
+	})
+}
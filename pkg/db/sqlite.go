@@ -0,0 +1,35 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var sqliteDriver = Driver{
+	SQLDriver: sqlite.DriverName,
+	DSN: func(cfg *config.DatabaseConfig) (string, error) {
+		if cfg.SQLite == nil {
+			return "", errors.New("database.sqlite is not set")
+		}
+
+		return cfg.SQLite.FormatDSN(), nil
+	},
+	Dialector: func(pool *sql.DB) gorm.Dialector {
+		return sqlite.Dialector{Conn: pool}
+	},
+	Tune: func(cfg *config.DatabaseConfig, pool *sql.DB) {
+		// Every connection to an in-memory database gets a database of
+		// its own: keep a single one open for the life of the pool.
+		if cfg.SQLite.InMemory() {
+			pool.SetMaxOpenConns(1)
+			pool.SetMaxIdleConns(1)
+			pool.SetConnMaxLifetime(0)
+			pool.SetConnMaxIdleTime(0)
+		}
+	},
+}
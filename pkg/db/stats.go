@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// PoolSQL and PoolRedis are the PoolStats kinds.
+	PoolSQL   = "sql"
+	PoolRedis = "redis"
+)
+
+// PoolStats is a snapshot of a connection pool, common to database/sql
+// and go-redis pools. Counters are cumulative since the pool was opened.
+type PoolStats struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+
+	// MaxOpen is the pool size limit, 0 when unlimited or unknown.
+	MaxOpen int `json:"maxOpen"`
+	Open    int `json:"open"`
+	InUse   int `json:"inUse"`
+	Idle    int `json:"idle"`
+
+	// WaitCount and WaitDuration count the waits for a free connection
+	// of SQL pools. Timeouts counts the waits of Redis pools given up
+	// after PoolTimeout.
+	WaitCount    int64         `json:"waitCount"`
+	WaitDuration time.Duration `json:"waitDuration"`
+	Timeouts     int64         `json:"timeouts"`
+}
+
+// Saturation returns the share of MaxOpen in use, from 0 to 1, or 0 when
+// the pool is unlimited.
+func (s PoolStats) Saturation() float64 {
+	if s.MaxOpen <= 0 {
+		return 0
+	}
+
+	return float64(s.InUse) / float64(s.MaxOpen)
+}
+
+// StatsCollector gathers the stats of the registered connection pools.
+// It is safe for concurrent use.
+type StatsCollector struct {
+	mu    sync.RWMutex
+	pools map[string]func() PoolStats
+}
+
+// NewStatsCollector creates an empty StatsCollector.
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{pools: make(map[string]func() PoolStats)}
+}
+
+// AddSQL registers the database/sql pool db under name.
+func (c *StatsCollector) AddSQL(name string, db *sql.DB) {
+	c.add(name, func() PoolStats {
+		s := db.Stats()
+		return PoolStats{
+			Name:         name,
+			Kind:         PoolSQL,
+			MaxOpen:      s.MaxOpenConnections,
+			Open:         s.OpenConnections,
+			InUse:        s.InUse,
+			Idle:         s.Idle,
+			WaitCount:    s.WaitCount,
+			WaitDuration: s.WaitDuration,
+		}
+	})
+}
+
+// AddRedis registers the pool of client under name. The pools of every
+// node of a Cluster client are summed up.
+func (c *StatsCollector) AddRedis(name string, client redis.UniversalClient) {
+	var maxOpen int
+	if simple, ok := client.(*redis.Client); ok {
+		maxOpen = simple.Options().PoolSize
+	}
+
+	c.add(name, func() PoolStats {
+		s := client.PoolStats()
+		return PoolStats{
+			Name:     name,
+			Kind:     PoolRedis,
+			MaxOpen:  maxOpen,
+			Open:     int(s.TotalConns),
+			InUse:    int(s.TotalConns - s.IdleConns),
+			Idle:     int(s.IdleConns),
+			Timeouts: int64(s.Timeouts),
+		}
+	})
+}
+
+// Remove unregisters the pool registered under name.
+func (c *StatsCollector) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pools, name)
+}
+
+// Collect returns the current stats of every pool, sorted by name.
+func (c *StatsCollector) Collect() []PoolStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := make([]PoolStats, 0, len(c.pools))
+	for _, collect := range c.pools {
+		stats = append(stats, collect())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+func (c *StatsCollector) add(name string, collect func() PoolStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pools[name] = collect
+}
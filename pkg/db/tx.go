@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// mysqlDeadlock is ER_LOCK_DEADLOCK.
+	mysqlDeadlock = 1213
+	// postgresDeadlock is deadlock_detected.
+	postgresDeadlock = "40P01"
+)
+
+// defaultTxRetry retries deadlocked transactions quickly: the competing
+// transaction has been rolled back by the time the error is returned.
+var defaultTxRetry = config.RetryConfig{
+	MaxAttempts:     3,
+	InitialInterval: 20 * time.Millisecond,
+	MaxInterval:     500 * time.Millisecond,
+	Multiplier:      2,
+	Jitter:          0.5,
+}
+
+// TxOptions configures a TxManager.
+type TxOptions struct {
+	// Retry is the backoff of the transactions failing with a retryable
+	// error. Defaults to 3 attempts 20ms apart, doubling.
+	Retry config.RetryConfig
+	// IsRetryable tells which errors retry the whole transaction.
+	// Defaults to IsDeadlock.
+	IsRetryable func(err error) bool
+	// Isolation, when set, is the isolation level of the transactions.
+	Isolation sql.IsolationLevel
+	// Logger, when set, logs the retries.
+	Logger logger.Logger
+}
+
+// TxManager runs funcs in a transaction carried by their context, so the
+// repositories they call share it through Conn.
+type TxManager struct {
+	db   *gorm.DB
+	opts TxOptions
+}
+
+// NewTxManager returns a TxManager starting its transactions on db.
+func NewTxManager(db *gorm.DB, opts TxOptions) *TxManager {
+	if opts.Retry == (config.RetryConfig{}) {
+		opts.Retry = defaultTxRetry
+	}
+	opts.Retry = opts.Retry.WithDefaults()
+	if opts.IsRetryable == nil {
+		opts.IsRetryable = IsDeadlock
+	}
+
+	return &TxManager{db: db, opts: opts}
+}
+
+type txKey struct{}
+
+// txState is a transaction, or a savepoint of one, and the hooks to run
+// once it commits.
+type txState struct {
+	tx *gorm.DB
+
+	mu    sync.Mutex
+	hooks []func(ctx context.Context)
+}
+
+func (s *txState) addHooks(hooks ...func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = append(s.hooks, hooks...)
+}
+
+// Do runs fn in a transaction: it commits when fn returns nil and rolls
+// back when fn returns an error or panics. fn gets a context carrying
+// the transaction, which Conn picks up. Called with such a context, Do
+// runs fn in a savepoint of the current transaction instead, so that
+// only the work of fn is rolled back on error.
+//
+// A transaction failing with a retryable error, a deadlock by default,
+// is retried as a whole, so fn must not have side effects outside the
+// database: defer them with AfterCommit.
+func (m *TxManager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if parent, ok := ctx.Value(txKey{}).(*txState); ok {
+		return m.savepoint(ctx, parent, fn)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := m.transaction(ctx, fn)
+		if err == nil || attempt >= m.opts.Retry.MaxAttempts || !m.opts.IsRetryable(err) {
+			return err
+		}
+
+		wait := Backoff(m.opts.Retry, attempt)
+		if m.opts.Logger != nil {
+			m.opts.Logger.Warnf("transaction attempt %d/%d failed, retrying in %s: %v", attempt, m.opts.Retry.MaxAttempts, wait, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *TxManager) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	var opts *sql.TxOptions
+	if m.opts.Isolation != sql.LevelDefault {
+		opts = &sql.TxOptions{Isolation: m.opts.Isolation}
+	}
+
+	state := &txState{}
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(context.WithValue(ctx, txKey{}, state))
+	}, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range state.hooks {
+		hook(ctx)
+	}
+
+	return nil
+}
+
+func (m *TxManager) savepoint(ctx context.Context, parent *txState, fn func(ctx context.Context) error) error {
+	state := &txState{}
+	err := parent.tx.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(context.WithValue(ctx, txKey{}, state))
+	})
+	if err != nil {
+		return err
+	}
+
+	// The savepoint is released: its hooks now depend on the parent.
+	parent.addHooks(state.hooks...)
+
+	return nil
+}
+
+// Conn returns the transaction carried by ctx, or db outside of one,
+// bound to ctx. Repositories call it for every query so that they take
+// part in the transaction of TxManager.Do.
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx.WithContext(ctx)
+	}
+
+	return db.WithContext(ctx)
+}
+
+// InTx reports whether ctx carries a transaction.
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// AfterCommit runs hook once the transaction carried by ctx commits,
+// with the context given to TxManager.Do. The hook is dropped if the
+// transaction, or the savepoint it was added in, rolls back. Outside of
+// a transaction, hook runs right away.
+func AfterCommit(ctx context.Context, hook func(ctx context.Context)) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		hook(ctx)
+		return
+	}
+
+	state.addHooks(hook)
+}
+
+// IsDeadlock reports whether err is a deadlock detected by MySQL or
+// PostgreSQL, which rolls the transaction back.
+func IsDeadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDeadlock
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == postgresDeadlock
+	}
+
+	return false
+}
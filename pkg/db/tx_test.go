@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type txItem struct {
+	ID   uint
+	Name string
+}
+
+// openTestDB opens a SQLite database in a temporary file, so that its
+// connections share it, with the txItem table.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&txItem{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func itemNames(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var names []string
+	if err := db.Model(&txItem{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func insert(ctx context.Context, db *gorm.DB, name string) error {
+	return Conn(ctx, db).Create(&txItem{Name: name}).Error
+}
+
+func TestTxNestedRollsBackSavepointOnly(t *testing.T) {
+	db := openTestDB(t)
+	tm := NewTxManager(db, TxOptions{})
+	errInner := errors.New("inner failed")
+
+	err := tm.Do(context.Background(), func(ctx context.Context) error {
+		if err := insert(ctx, db, "outer"); err != nil {
+			return err
+		}
+		err := tm.Do(ctx, func(ctx context.Context) error {
+			if err := insert(ctx, db, "inner"); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("nested Do = %v, want %v", err, errInner)
+		}
+		return insert(ctx, db, "after")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := itemNames(t, db); len(names) != 2 || names[0] != "outer" || names[1] != "after" {
+		t.Errorf("committed %v, want [outer after]", names)
+	}
+}
+
+func TestTxRetry(t *testing.T) {
+	errRetryable := errors.New("retryable")
+	errFatal := errors.New("fatal")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		want     error
+		attempts int
+	}{
+		{name: "retryable error retried", errs: []error{errRetryable, nil}, want: nil, attempts: 2},
+		{name: "non retryable error", errs: []error{errFatal, nil}, want: errFatal, attempts: 1},
+		{name: "attempts exhausted", errs: []error{errRetryable, errRetryable, errRetryable, nil}, want: errRetryable, attempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			tm := NewTxManager(db, TxOptions{
+				Retry:       config.RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond},
+				IsRetryable: func(err error) bool { return errors.Is(err, errRetryable) },
+			})
+
+			attempts := 0
+			err := tm.Do(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if err := insert(ctx, db, "item"); err != nil {
+					return err
+				}
+				return tt.errs[attempts-1]
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Do = %v, want %v", err, tt.want)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("%d attempts, want %d", attempts, tt.attempts)
+			}
+			// Only the successful attempt is committed.
+			committed := 0
+			if tt.want == nil {
+				committed = 1
+			}
+			if names := itemNames(t, db); len(names) != committed {
+				t.Errorf("committed %v", names)
+			}
+		})
+	}
+}
+
+func TestTxAfterCommit(t *testing.T) {
+	db := openTestDB(t)
+	tm := NewTxManager(db, TxOptions{})
+
+	var ran []string
+	hook := func(name string) func(ctx context.Context) {
+		return func(context.Context) { ran = append(ran, name) }
+	}
+
+	err := tm.Do(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, hook("outer"))
+		_ = tm.Do(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, hook("released savepoint"))
+			return nil
+		})
+		_ = tm.Do(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, hook("rolled back savepoint"))
+			return errors.New("rollback")
+		})
+		if len(ran) != 0 {
+			t.Errorf("hooks %v ran before the commit", ran)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0] != "outer" || ran[1] != "released savepoint" {
+		t.Errorf("hooks ran: %v, want [outer released savepoint]", ran)
+	}
+
+	ran = nil
+	_ = tm.Do(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, hook("rolled back"))
+		return errors.New("rollback")
+	})
+	if len(ran) != 0 {
+		t.Errorf("hooks of a rolled back transaction ran: %v", ran)
+	}
+
+	AfterCommit(context.Background(), hook("outside"))
+	if len(ran) != 1 {
+		t.Error("hook outside a transaction did not run right away")
+	}
+}
+
+func TestTxPanicRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	tm := NewTxManager(db, TxOptions{})
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recovered %v, want the panic of fn", r)
+			}
+		}()
+		_ = tm.Do(context.Background(), func(ctx context.Context) error {
+			if err := insert(ctx, db, "item"); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	if names := itemNames(t, db); len(names) != 0 {
+		t.Errorf("committed %v after a panic", names)
+	}
+}
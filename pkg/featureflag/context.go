@@ -0,0 +1,55 @@
+package featureflag
+
+import "context"
+
+type contextKey int
+
+const (
+	clientKey contextKey = iota
+	userKey
+	tenantKey
+)
+
+// WithClient returns a copy of ctx carrying c, for Enabled.
+func WithClient(ctx context.Context, c *Client) context.Context {
+	return context.WithValue(ctx, clientKey, c)
+}
+
+// FromContext returns the Client carried by ctx, or nil.
+func FromContext(ctx context.Context) *Client {
+	c, _ := ctx.Value(clientKey).(*Client)
+	return c
+}
+
+// WithUser returns a copy of ctx targeting flags at the user id.
+func WithUser(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userKey, id)
+}
+
+// UserFromContext returns the user id set by WithUser.
+func UserFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userKey).(string)
+	return id
+}
+
+// WithTenant returns a copy of ctx targeting flags at the tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey, id)
+}
+
+// TenantFromContext returns the tenant id set by WithTenant.
+func TenantFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey).(string)
+	return id
+}
+
+// Enabled reports whether the flag name is on for ctx, using the Client
+// and the user and tenant ctx carries. It is false without a Client.
+func Enabled(ctx context.Context, name string) bool {
+	c := FromContext(ctx)
+	if c == nil {
+		return false
+	}
+
+	return c.Enabled(ctx, name)
+}
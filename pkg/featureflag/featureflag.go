@@ -0,0 +1,164 @@
+package featureflag
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+const defaultKeyPrefix = "featureflags"
+
+// Flag is the evaluated definition of a feature flag.
+// See config.FeatureFlagConfig for the targeting rules.
+type Flag struct {
+	Enabled    bool     `json:"enabled"`
+	Percentage int      `json:"percentage"`
+	Users      []string `json:"users,omitempty"`
+	Tenants    []string `json:"tenants,omitempty"`
+}
+
+// Options configures a Client.
+type Options struct {
+	// KeyPrefix names the Redis hash holding the overrides and, with a
+	// ":changes" suffix, the channel announcing them. Defaults to "featureflags".
+	KeyPrefix string
+}
+
+// Client evaluates feature flags defined in config and overridden at
+// runtime in Redis. Overrides take precedence over the config definition
+// and are propagated to every instance through pub/sub.
+type Client struct {
+	redis   redis.UniversalClient
+	logger  logger.Logger
+	key     string
+	channel string
+
+	mu        sync.RWMutex
+	defaults  map[string]Flag
+	overrides map[string]Flag
+
+	pubsub    *redis.PubSub
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a Client for the flags of cfg. rdb may be nil, in which
+// case only the config definitions are used.
+func New(flags map[string]config.FeatureFlagConfig, rdb redis.UniversalClient, logger logger.Logger, opts Options) *Client {
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = defaultKeyPrefix
+	}
+
+	c := &Client{
+		redis:     rdb,
+		logger:    logger,
+		key:       opts.KeyPrefix,
+		channel:   opts.KeyPrefix + ":changes",
+		overrides: make(map[string]Flag),
+		done:      make(chan struct{}),
+	}
+	c.SetDefaults(flags)
+
+	return c
+}
+
+// SetDefaults replaces the flags defined in config, e.g. after a reload.
+func (c *Client) SetDefaults(flags map[string]config.FeatureFlagConfig) {
+	defaults := make(map[string]Flag, len(flags))
+	for name, f := range flags {
+		defaults[flagKey(name)] = Flag{
+			Enabled:    f.Enabled,
+			Percentage: f.Percentage,
+			Users:      f.Users,
+			Tenants:    f.Tenants,
+		}
+	}
+
+	c.mu.Lock()
+	c.defaults = defaults
+	c.mu.Unlock()
+}
+
+// Flag returns the effective definition of the flag name.
+func (c *Client) Flag(name string) (Flag, bool) {
+	name = flagKey(name)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if f, ok := c.overrides[name]; ok {
+		return f, true
+	}
+	f, ok := c.defaults[name]
+
+	return f, ok
+}
+
+// Enabled reports whether the flag name is on for the user and tenant
+// carried by ctx. Unknown flags are off.
+func (c *Client) Enabled(ctx context.Context, name string) bool {
+	name = flagKey(name)
+	f, ok := c.Flag(name)
+	if !ok {
+		return false
+	}
+
+	return f.Evaluate(name, UserFromContext(ctx), TenantFromContext(ctx))
+}
+
+// Evaluate reports whether the flag name is on for user and tenant.
+func (f Flag) Evaluate(name, user, tenant string) bool {
+	if !f.Enabled {
+		return false
+	}
+	if (user != "" && contains(f.Users, user)) || (tenant != "" && contains(f.Tenants, tenant)) {
+		return true
+	}
+
+	switch {
+	case f.Percentage <= 0:
+		return false
+	case f.Percentage >= 100:
+		return true
+	}
+
+	subject := user
+	if subject == "" {
+		subject = tenant
+	}
+	if subject == "" {
+		return false
+	}
+
+	return bucket(name, subject) < f.Percentage
+}
+
+// flagKey returns the key of the flag name. Flag names are
+// case-insensitive, like the config keys they are defined by.
+func flagKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// bucket spreads subjects over [0, 100) consistently for a flag, so a
+// subject stays in the rollout as the percentage grows.
+func bucket(name, subject string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + subject))
+
+	return int(h.Sum32() % 100)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		flag   Flag
+		user   string
+		tenant string
+		want   bool
+	}{
+		{name: "disabled", flag: Flag{Percentage: 100}, user: "u1", want: false},
+		{name: "zero percent", flag: Flag{Enabled: true}, user: "u1", want: false},
+		{name: "zero percent without subject", flag: Flag{Enabled: true}, want: false},
+		{name: "everyone", flag: Flag{Enabled: true, Percentage: 100}, want: true},
+		{name: "listed user", flag: Flag{Enabled: true, Users: []string{"u1"}}, user: "u1", want: true},
+		{name: "listed tenant", flag: Flag{Enabled: true, Tenants: []string{"t1"}}, user: "u2", tenant: "t1", want: true},
+		{name: "unlisted user", flag: Flag{Enabled: true, Users: []string{"u1"}}, user: "u2", want: false},
+		{name: "rollout without subject", flag: Flag{Enabled: true, Percentage: 50}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.flag.Evaluate("flag", tt.user, tt.tenant); got != tt.want {
+				t.Errorf("Evaluate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluatePercentage(t *testing.T) {
+	f := Flag{Enabled: true, Percentage: 30}
+	on := 0
+	for i := 0; i < 1000; i++ {
+		if f.Evaluate("flag", fmt.Sprintf("user-%d", i), "") {
+			on++
+		}
+	}
+	if on < 200 || on > 400 {
+		t.Errorf("%d of 1000 users in a 30%% rollout", on)
+	}
+}
+
+func TestFlagNamesAreCaseInsensitive(t *testing.T) {
+	// Viper lowercases the keys of the featureFlags map.
+	c := New(map[string]config.FeatureFlagConfig{
+		"newcheckout": {Enabled: true, Percentage: 100},
+	}, nil, nil, Options{})
+
+	if _, ok := c.Flag("newCheckout"); !ok {
+		t.Error("newCheckout not found")
+	}
+	if !c.Enabled(context.Background(), "NewCheckout") {
+		t.Error("NewCheckout disabled")
+	}
+}
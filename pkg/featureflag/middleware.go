@@ -0,0 +1,35 @@
+package featureflag
+
+import "github.com/labstack/echo/v4"
+
+// SubjectFunc returns the user and tenant the flags of the request of c
+// are evaluated for, as established by authentication, e.g. from the
+// principal the authentication middleware stored in c. It must not
+// trust client supplied values such as unverified headers, which would
+// let a client pose as a targeted user or pick its rollout bucket.
+type SubjectFunc func(c echo.Context) (user, tenant string)
+
+// Middleware stores client and the request subject in the request
+// context, so handlers and services can call Enabled with it. subject
+// is required.
+func Middleware(client *Client, subject SubjectFunc) echo.MiddlewareFunc {
+	if subject == nil {
+		panic("featureflag: Middleware needs a SubjectFunc")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := WithClient(c.Request().Context(), client)
+			user, tenant := subject(c)
+			if user != "" {
+				ctx = WithUser(ctx, user)
+			}
+			if tenant != "" {
+				ctx = WithTenant(ctx, tenant)
+			}
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package featureflag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+)
+
+func TestMiddlewareSubject(t *testing.T) {
+	client := New(map[string]config.FeatureFlagConfig{
+		"beta": {Enabled: true, Users: []string{"alice"}},
+	}, nil, nil, Options{})
+
+	// principal stands for the authentication middleware.
+	principal := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("Authorization") == "Bearer alice-token" {
+				c.Set("user", "alice")
+			}
+			return next(c)
+		}
+	}
+	subject := func(c echo.Context) (string, string) {
+		user, _ := c.Get("user").(string)
+		return user, ""
+	}
+
+	e := echo.New()
+	e.Use(principal, Middleware(client, subject))
+	e.GET("/", func(c echo.Context) error {
+		if Enabled(c.Request().Context(), "beta") {
+			return c.String(http.StatusOK, "beta")
+		}
+		return c.String(http.StatusOK, "stable")
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{name: "authenticated user", header: "Authorization", value: "Bearer alice-token", want: "beta"},
+		{name: "user header ignored", header: "X-User-ID", value: "alice", want: "stable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNeedsSubject(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Middleware accepted a nil SubjectFunc")
+		}
+	}()
+	Middleware(New(nil, nil, nil, Options{}), nil)
+}
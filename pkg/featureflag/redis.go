@@ -0,0 +1,161 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// listenBuffer is the number of changes buffered while they are applied.
+const listenBuffer = 100
+
+// Start loads the overrides stored in Redis and follows their changes
+// until Close is called. It is a no-op without a Redis client.
+func (c *Client) Start(ctx context.Context) error {
+	if c.redis == nil {
+		return nil
+	}
+
+	c.pubsub = c.redis.Subscribe(ctx, c.channel)
+	// Wait for the subscription so no change is missed after the first load.
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		_ = c.pubsub.Close()
+		return err
+	}
+
+	if err := c.loadOverrides(ctx); err != nil {
+		_ = c.pubsub.Close()
+		return err
+	}
+
+	go c.listen()
+
+	return nil
+}
+
+// Close stops following changes. Calls after the first are no-ops.
+func (c *Client) Close() error {
+	if c.pubsub == nil {
+		return nil
+	}
+
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.pubsub.Close()
+	})
+
+	return err
+}
+
+// Set overrides the flag name in Redis and notifies every instance.
+func (c *Client) Set(ctx context.Context, name string, f Flag) error {
+	if c.redis == nil {
+		return errors.New("featureflag: no redis client")
+	}
+
+	name = flagKey(name)
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := c.redis.HSet(ctx, c.key, name, data).Err(); err != nil {
+		return err
+	}
+
+	return c.redis.Publish(ctx, c.channel, name).Err()
+}
+
+// Delete removes the override of the flag name, reverting it to its
+// config definition on every instance.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	if c.redis == nil {
+		return errors.New("featureflag: no redis client")
+	}
+
+	name = flagKey(name)
+	if err := c.redis.HDel(ctx, c.key, name).Err(); err != nil {
+		return err
+	}
+
+	return c.redis.Publish(ctx, c.channel, name).Err()
+}
+
+func (c *Client) listen() {
+	ch := c.pubsub.ChannelWithSubscriptions(context.Background(), listenBuffer)
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch msg := msg.(type) {
+			case *redis.Subscription:
+				// Start consumed the first confirmation: this one follows a
+				// reconnect, and changes published meanwhile were missed.
+				if msg.Kind != "subscribe" {
+					continue
+				}
+				if err := c.loadOverrides(context.Background()); err != nil {
+					c.logger.Errorf("featureflag: reload after reconnect: %v", err)
+				}
+			case *redis.Message:
+				if err := c.loadOverride(context.Background(), msg.Payload); err != nil {
+					c.logger.Errorf("featureflag: reload %s: %v", msg.Payload, err)
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) loadOverrides(ctx context.Context) error {
+	values, err := c.redis.HGetAll(ctx, c.key).Result()
+	if err != nil {
+		return err
+	}
+
+	overrides := make(map[string]Flag, len(values))
+	for name, data := range values {
+		var f Flag
+		if err := json.Unmarshal([]byte(data), &f); err != nil {
+			c.logger.Errorf("featureflag: invalid override %s: %v", name, err)
+			continue
+		}
+		overrides[flagKey(name)] = f
+	}
+
+	c.mu.Lock()
+	c.overrides = overrides
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *Client) loadOverride(ctx context.Context, name string) error {
+	name = flagKey(name)
+	data, err := c.redis.HGet(ctx, c.key, name).Result()
+	if errors.Is(err, redis.Nil) {
+		c.mu.Lock()
+		delete(c.overrides, name)
+		c.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var f Flag
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.overrides[name] = f
+	c.mu.Unlock()
+
+	return nil
+}
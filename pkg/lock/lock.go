@@ -0,0 +1,293 @@
+// Package lock provides locks shared by the instances of a service, e.g.
+// so that a cron job runs on one replica at a time.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+const (
+	defaultTTL           = 10 * time.Second
+	defaultRetryInterval = 100 * time.Millisecond
+	// releaseTimeout bounds the release of the lock by Do, which does
+	// not use the context of fn as it may be done.
+	releaseTimeout = 5 * time.Second
+)
+
+var (
+	// ErrNotAcquired is returned by TryAcquire when the lock is held by
+	// another holder.
+	ErrNotAcquired = errors.New("lock: held by another holder")
+	// ErrNotHeld is returned when extending or releasing a lock whose
+	// lease expired, and which another holder may have taken since.
+	ErrNotHeld = errors.New("lock: not held")
+)
+
+// Options configures a Locker.
+type Options struct {
+	// TTL is the lease of the locks, extended every TTL/3 while they are
+	// held, so a crashed holder frees its locks after at most TTL.
+	// Defaults to 10s.
+	TTL time.Duration
+	// RetryInterval is how often Acquire retries while the lock is held.
+	// Defaults to 100ms.
+	RetryInterval time.Duration
+	// WaitTimeout, when set, bounds how long Acquire waits for a lock,
+	// besides the context.
+	WaitTimeout time.Duration
+	// Logger, when set, logs the failures to extend a lease.
+	Logger logger.Logger
+}
+
+func (o Options) withDefaults() Options {
+	if o.TTL <= 0 {
+		o.TTL = defaultTTL
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = defaultRetryInterval
+	}
+
+	return o
+}
+
+// Locker hands out named locks.
+type Locker interface {
+	// TryAcquire takes the lock named key, or fails with ErrNotAcquired
+	// if it is held.
+	TryAcquire(ctx context.Context, key string) (*Lock, error)
+	// Acquire waits until it takes the lock named key, or until ctx is
+	// done or the wait times out.
+	Acquire(ctx context.Context, key string) (*Lock, error)
+}
+
+// store is the storage of the leases of a locker.
+type store interface {
+	// acquire sets the lease of key to owner if it is free, and returns
+	// the next fencing token of key, or ErrNotAcquired.
+	acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error)
+	// extend renews the lease of key by owner, or returns ErrNotHeld.
+	extend(ctx context.Context, key, owner string, ttl time.Duration) error
+	// release deletes the lease of key by owner, or returns ErrNotHeld.
+	release(ctx context.Context, key, owner string) error
+}
+
+// locker implements Locker on a store.
+type locker struct {
+	store store
+	opts  Options
+}
+
+func newLocker(s store, opts Options) *locker {
+	return &locker{store: s, opts: opts.withDefaults()}
+}
+
+func (l *locker) TryAcquire(ctx context.Context, key string) (*Lock, error) {
+	owner, err := newOwner()
+	if err != nil {
+		return nil, err
+	}
+	token, err := l.store.acquire(ctx, key, owner, l.opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lock{
+		key:    key,
+		owner:  owner,
+		token:  token,
+		locker: l,
+		lost:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	var keepAliveCtx context.Context
+	keepAliveCtx, lock.stopKeepAlive = context.WithCancel(context.Background())
+	go lock.keepAlive(keepAliveCtx)
+
+	return lock, nil
+}
+
+func (l *locker) Acquire(ctx context.Context, key string) (*Lock, error) {
+	if l.opts.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.opts.WaitTimeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(l.opts.RetryInterval)
+	defer ticker.Stop()
+	for {
+		lock, err := l.TryAcquire(ctx, key)
+		switch {
+		case err == nil:
+			return lock, nil
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("lock: waiting for %q: %w", key, ctx.Err())
+		case !errors.Is(err, ErrNotAcquired):
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("lock: waiting for %q: %w", key, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lock is a held lock. Its lease is extended in the background until it
+// is released, or lost because extending it failed for a whole TTL.
+type Lock struct {
+	key    string
+	owner  string
+	token  int64
+	locker *locker
+
+	lost     chan struct{}
+	lostOnce sync.Once
+
+	stopKeepAlive context.CancelFunc
+	done          chan struct{}
+}
+
+// Key returns the name of the lock.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the fencing token of the lock, greater than the token of
+// every previous holder of the same key. Pass it along with the writes
+// made under the lock, so the stores they go to can reject the writes of
+// a former holder whose lease expired, e.g. after a long GC pause.
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Lost returns a channel closed when the lease of the lock is lost.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Extend renews the lease of the lock for a TTL now, or returns
+// ErrNotHeld if it was lost.
+func (l *Lock) Extend(ctx context.Context) error {
+	err := l.locker.store.extend(ctx, l.key, l.owner, l.locker.opts.TTL)
+	if errors.Is(err, ErrNotHeld) {
+		l.markLost()
+	}
+
+	return err
+}
+
+// Release frees the lock. It returns ErrNotHeld if the lease was lost,
+// in which case the work done under the lock may have overlapped with
+// another holder's.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopKeepAlive()
+	<-l.done
+
+	err := l.locker.store.release(ctx, l.key, l.owner)
+	if errors.Is(err, ErrNotHeld) {
+		l.markLost()
+	}
+
+	return err
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// keepAlive extends the lease every TTL/3 until ctx is done or the lease
+// is lost.
+func (l *Lock) keepAlive(ctx context.Context) {
+	defer close(l.done)
+
+	ttl := l.locker.opts.TTL
+	interval := ttl / 3
+	expires := time.Now().Add(ttl)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		extendCtx, cancel := context.WithTimeout(ctx, interval)
+		err := l.Extend(extendCtx)
+		cancel()
+		switch {
+		case err == nil:
+			expires = start.Add(ttl)
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, ErrNotHeld):
+			l.warnf("lock: lease of %q lost", l.key)
+			return
+		default:
+			if time.Now().After(expires) {
+				l.markLost()
+				l.warnf("lock: lease of %q expired, failed to extend it: %v", l.key, err)
+				return
+			}
+			l.warnf("lock: failed to extend the lease of %q: %v", l.key, err)
+		}
+	}
+}
+
+func (l *Lock) warnf(template string, args ...interface{}) {
+	if l.locker.opts.Logger != nil {
+		l.locker.opts.Logger.Warnf(template, args...)
+	}
+}
+
+// Do runs fn holding the lock named key, waiting for it with Acquire.
+// The context of fn is cancelled if the lock is lost, and Do then
+// returns ErrNotHeld unless fn failed.
+func Do(ctx context.Context, locker Locker, key string, fn func(ctx context.Context) error) error {
+	lock, err := locker.Acquire(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+
+	err = fn(fnCtx)
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancelRelease()
+	if releaseErr := lock.Release(releaseCtx); err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+// newOwner returns a random value identifying a holder of a lease.
+func newOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("lock: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
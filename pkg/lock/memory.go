@@ -0,0 +1,79 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker is a Locker keeping the leases in memory, for tests and
+// single instance setups. Its locks are only shared within the process.
+type MemoryLocker struct {
+	*locker
+}
+
+func NewMemoryLocker(opts Options) *MemoryLocker {
+	return &MemoryLocker{locker: newLocker(&memoryStore{
+		leases: make(map[string]memoryLease),
+		tokens: make(map[string]int64),
+	}, opts)}
+}
+
+type memoryLease struct {
+	owner   string
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+	tokens map[string]int64
+}
+
+// held returns whether the lease of key is held by owner, or by anyone
+// when owner is empty.
+func (s *memoryStore) held(key, owner string) bool {
+	lease, ok := s.leases[key]
+	if !ok || time.Now().After(lease.expires) {
+		return false
+	}
+
+	return owner == "" || lease.owner == owner
+}
+
+func (s *memoryStore) acquire(_ context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.held(key, "") {
+		return 0, ErrNotAcquired
+	}
+	s.leases[key] = memoryLease{owner: owner, expires: time.Now().Add(ttl)}
+	s.tokens[key]++
+
+	return s.tokens[key], nil
+}
+
+func (s *memoryStore) extend(_ context.Context, key, owner string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.held(key, owner) {
+		return ErrNotHeld
+	}
+	s.leases[key] = memoryLease{owner: owner, expires: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (s *memoryStore) release(_ context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.held(key, owner) {
+		return ErrNotHeld
+	}
+	delete(s.leases, key)
+
+	return nil
+}
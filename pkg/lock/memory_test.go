@@ -0,0 +1,173 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// expire ends the lease of key as if its holder had stalled for a TTL.
+func expire(l *MemoryLocker, key string) {
+	s := l.store.(*memoryStore)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease := s.leases[key]
+	lease.expires = time.Now().Add(-time.Millisecond)
+	s.leases[key] = lease
+}
+
+func TestTryAcquireContention(t *testing.T) {
+	l := NewMemoryLocker(Options{})
+	ctx := context.Background()
+
+	first, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.TryAcquire(ctx, "job"); !errors.Is(err, ErrNotAcquired) {
+		t.Errorf("TryAcquire of a held lock = %v, want ErrNotAcquired", err)
+	}
+	other, err := l.TryAcquire(ctx, "other")
+	if err != nil {
+		t.Fatalf("TryAcquire of another key = %v", err)
+	}
+	_ = other.Release(ctx)
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire after release = %v", err)
+	}
+	if second.Token() <= first.Token() {
+		t.Errorf("token %d after %d, want it to increase", second.Token(), first.Token())
+	}
+	_ = second.Release(ctx)
+}
+
+func TestFencingTokenAfterExpiry(t *testing.T) {
+	l := NewMemoryLocker(Options{})
+	ctx := context.Background()
+
+	first, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(l, "job")
+	second, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire of an expired lock = %v", err)
+	}
+	defer second.Release(ctx)
+
+	if second.Token() <= first.Token() {
+		t.Errorf("token %d after %d, want it to increase", second.Token(), first.Token())
+	}
+}
+
+func TestAcquireWaits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("until released", func(t *testing.T) {
+		l := NewMemoryLocker(Options{RetryInterval: time.Millisecond})
+		held, err := l.TryAcquire(ctx, "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(20*time.Millisecond, func() { _ = held.Release(ctx) })
+
+		lock, err := l.Acquire(ctx, "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = lock.Release(ctx)
+	})
+
+	t.Run("wait timeout", func(t *testing.T) {
+		l := NewMemoryLocker(Options{RetryInterval: time.Millisecond, WaitTimeout: 20 * time.Millisecond})
+		held, err := l.TryAcquire(ctx, "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer held.Release(ctx)
+
+		start := time.Now()
+		if _, err := l.Acquire(ctx, "job"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Acquire = %v, want a deadline error", err)
+		}
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("Acquire waited %s", waited)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		l := NewMemoryLocker(Options{RetryInterval: time.Millisecond})
+		held, err := l.TryAcquire(ctx, "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer held.Release(ctx)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		time.AfterFunc(20*time.Millisecond, cancel)
+		if _, err := l.Acquire(cancelled, "job"); !errors.Is(err, context.Canceled) {
+			t.Errorf("Acquire = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestReleaseAfterExpiry(t *testing.T) {
+	l := NewMemoryLocker(Options{TTL: time.Hour})
+	ctx := context.Background()
+
+	lock, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(l, "job")
+
+	if err := lock.Release(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Release = %v, want ErrNotHeld", err)
+	}
+	select {
+	case <-lock.Lost():
+	default:
+		t.Error("Lost not closed")
+	}
+}
+
+func TestDoCancelsOnLostLease(t *testing.T) {
+	l := NewMemoryLocker(Options{TTL: 30 * time.Millisecond})
+
+	err := Do(context.Background(), l, "job", func(ctx context.Context) error {
+		expire(l, "job")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+			t.Error("context of fn not cancelled")
+			return nil
+		}
+	})
+	if !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Do = %v, want ErrNotHeld", err)
+	}
+}
+
+func TestDoReleases(t *testing.T) {
+	l := NewMemoryLocker(Options{})
+	ctx := context.Background()
+	errFn := errors.New("fn failed")
+
+	if err := Do(ctx, l, "job", func(context.Context) error { return errFn }); !errors.Is(err, errFn) {
+		t.Errorf("Do = %v, want the error of fn", err)
+	}
+	lock, err := l.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("lock still held after Do: %v", err)
+	}
+	_ = lock.Release(ctx)
+}
@@ -0,0 +1,101 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const defaultRedisPrefix = "lock:"
+
+// acquireScript sets the lease KEYS[1] to the owner ARGV[1] for ARGV[2]
+// milliseconds if it is free, and returns the incremented fencing token
+// KEYS[2], or 0.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// extendScript renews the lease KEYS[1] for ARGV[2] milliseconds if it
+// is held by the owner ARGV[1], and returns 1, or 0.
+var extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease KEYS[1] if it is held by the owner
+// ARGV[1], and returns 1, or 0.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker is a Locker keeping the leases in Redis, as keys set with
+// SET NX PX to a random value of their holder, which is checked before
+// extending or deleting them. The fencing token of a lock is a counter
+// next to its lease; both keys share a hash tag for Redis Cluster.
+type RedisLocker struct {
+	*locker
+}
+
+// NewRedisLocker returns a RedisLocker storing the leases in client,
+// e.g. the client of db.ConnectRedis, under keys starting with prefix,
+// "lock:" when empty.
+func NewRedisLocker(client redis.UniversalClient, prefix string, opts Options) *RedisLocker {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+
+	return &RedisLocker{locker: newLocker(&redisStore{client: client, prefix: prefix}, opts)}
+}
+
+type redisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// keys returns the lease and fencing token keys of key.
+func (s *redisStore) keys(key string) []string {
+	lease := s.prefix + "{" + key + "}"
+	return []string{lease, lease + ":token"}
+}
+
+func (s *redisStore) acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	token, err := acquireScript.Run(ctx, s.client, s.keys(key), owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if token == 0 {
+		return 0, ErrNotAcquired
+	}
+
+	return token, nil
+}
+
+func (s *redisStore) extend(ctx context.Context, key, owner string, ttl time.Duration) error {
+	return s.run(ctx, extendScript, key, owner, ttl.Milliseconds())
+}
+
+func (s *redisStore) release(ctx context.Context, key, owner string) error {
+	return s.run(ctx, releaseScript, key, owner)
+}
+
+// run runs a script checking the owner of the lease of key.
+func (s *redisStore) run(ctx context.Context, script *redis.Script, key string, args ...interface{}) error {
+	ok, err := script.Run(ctx, s.client, s.keys(key)[:1], args...).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrNotHeld
+	}
+
+	return nil
+}
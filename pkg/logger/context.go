@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	traceIDKey
+	loggerKey
+)
+
+// NewID returns a random 128-bit id in hex, the format of W3C trace ids,
+// for request and trace ids.
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithLogger returns a copy of ctx carrying l, for the code it is passed
+// to, e.g. stream message handlers.
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the Logger carried by ctx, or nil.
+func FromContext(ctx context.Context) Logger {
+	l, _ := ctx.Value(loggerKey).(Logger)
+	return l
+}
+
+// WithRequestID returns a copy of ctx carrying the request id, logged
+// with the SQL queries run for the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id set by WithRequestID.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTraceID returns a copy of ctx carrying the trace id.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+// TraceID returns the trace id set by WithTraceID.
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
+}
+
+// ContextFields returns the request and trace ids carried by ctx as
+// fields, requestId and traceId, leaving out the unset ones.
+func ContextFields(ctx context.Context) Fields {
+	fields := Fields{}
+	if id := RequestID(ctx); id != "" {
+		fields["requestId"] = id
+	}
+	if id := TraceID(ctx); id != "" {
+		fields["traceId"] = id
+	}
+
+	return fields
+}
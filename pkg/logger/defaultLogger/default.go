@@ -13,27 +13,28 @@ var (
 	Logger logger.Logger
 )
 
+// init builds the fallback logger from the same variables that
+// override logger.logType and logger.level, without a service prefix.
 func init() {
-	logType := os.Getenv("LogConfig_LogType")
-	if logType == "" {
-		logType = "Zap"
+	lc := &config.LoggerConfig{
+		LogLevel: os.Getenv(config.EnvName("", "logger.level")),
+		LogType:  config.Zap,
 	}
-	switch logType {
-	case "Zap":
-		Logger = zap.NewZapLogger(&config.LoggerConfig{
-			LogLevel: "debug",
-			LogType:  config.Zap,
-		}, &config.ServerConfig{
-			Mode: "Development",
-		})
-		break
-	case "Logrus":
-		Logger = logrous.NewLogrusLogger(&config.LoggerConfig{
-			LogLevel: "debug",
-			LogType:  config.Zap,
-		}, &config.ServerConfig{
-			Mode: "Development",
-		})
-		break
+	if lc.LogLevel == "" {
+		lc.LogLevel = "debug"
+	}
+	if logType, err := config.ParseLogType(os.Getenv(config.EnvName("", "logger.logType"))); err == nil {
+		lc.LogType = logType
+	}
+
+	sc := &config.ServerConfig{
+		Mode: "Development",
+	}
+
+	switch lc.LogType {
+	case config.Logrus:
+		Logger = logrous.NewLogrusLogger(lc, sc)
+	default:
+		Logger = zap.NewZapLogger(lc, sc)
 	}
 }
@@ -19,6 +19,7 @@ type Logger interface {
 	Infow(msg string, fields Fields)
 	Warn(args ...interface{})
 	Warnf(template string, args ...interface{})
+	Warnw(msg string, fields Fields)
 	WarnMsg(msg string, err error)
 	Error(args ...interface{})
 	Errorw(msg string, fields Fields)
@@ -27,6 +28,7 @@ type Logger interface {
 	Fatal(args ...interface{})
 	Fatalf(template string, args ...interface{})
 	Printf(template string, args ...interface{})
+	SetLevel(level string)
 	WithName(name string)
 	GrpcMiddlewareAccessLogger(method string, time time.Duration, metaData map[string][]string, err error)
 	GrpcClientInterceptorLogger(method string, req interface{}, reply interface{}, time time.Duration, metaData map[string][]string, err error)
@@ -77,6 +77,11 @@ func (l *logrusLogger) LogType() config.LogType {
 	return config.Logrus
 }
 
+func (l *logrusLogger) SetLevel(level string) {
+	l.level = level
+	l.logger.SetLevel(l.GetLoggerLevel())
+}
+
 func (l *logrusLogger) Configure(cfg func(internalLog interface{})) {
 	cfg(l.logger)
 }
@@ -115,6 +120,11 @@ func (l *logrusLogger) Warnf(template string, args ...interface{}) {
 	l.logger.Warnf(template, args...)
 }
 
+func (l *logrusLogger) Warnw(msg string, fields logger.Fields) {
+	entry := l.mapToFields(fields)
+	entry.Warn(msg)
+}
+
 func (l *logrusLogger) WarnMsg(msg string, err error) {
 	l.logger.Warn(msg, logrus.WithField("error", err.Error()))
 }
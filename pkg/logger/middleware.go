@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// traceparentHeader is the W3C Trace Context header,
+// "<version>-<trace id>-<parent id>-<flags>".
+const traceparentHeader = "traceparent"
+
+// ContextMiddleware stores the request id and trace id of the request in
+// its context, for ContextFields. The request id is read from the
+// X-Request-ID header, or generated, and returned in it; the trace id is
+// read from the traceparent header.
+func ContextMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if id == "" {
+			id = NewID()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		ctx = WithRequestID(ctx, id)
+		if traceID := parseTraceparent(req.Header.Get(traceparentHeader)); traceID != "" {
+			ctx = WithTraceID(ctx, traceID)
+		}
+		c.SetRequest(req.WithContext(ctx))
+
+		return next(c)
+	}
+}
+
+// parseTraceparent returns the trace id of a traceparent header, or "".
+func parseTraceparent(header string) string {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || strings.Trim(parts[1], "0") == "" {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+
+	return parts[1]
+}
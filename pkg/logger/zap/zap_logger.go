@@ -13,6 +13,7 @@ import (
 
 type zapLogger struct {
 	level       string
+	atomicLevel zap.AtomicLevel
 	sugarLogger *zap.SugaredLogger
 	logger      *zap.Logger
 }
@@ -91,7 +92,8 @@ func (l *zapLogger) initLogger(cfg *config.ServerConfig) {
 		encoder = zapcore.NewConsoleEncoder(encoderCfg)
 	}
 
-	core := zapcore.NewCore(encoder, logWriter, zap.NewAtomicLevelAt(logLevel))
+	l.atomicLevel = zap.NewAtomicLevelAt(logLevel)
+	core := zapcore.NewCore(encoder, logWriter, l.atomicLevel)
 	zapLogger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
 
 	l.logger = zapLogger
@@ -106,6 +108,12 @@ func (l *zapLogger) LogType() config.LogType {
 	return config.Zap
 }
 
+// SetLevel changes the minimum enabled level at runtime.
+func (l *zapLogger) SetLevel(level string) {
+	l.level = level
+	l.atomicLevel.SetLevel(l.getLoggerLevel())
+}
+
 // WithName add logger microservice name
 func (l *zapLogger) WithName(name string) {
 	l.logger = l.logger.Named(name)
@@ -153,6 +161,11 @@ func (l *zapLogger) Warn(args ...interface{}) {
 	l.sugarLogger.Warn(args...)
 }
 
+// Warnw logs a message with fields at warn level.
+func (l *zapLogger) Warnw(msg string, fields logger.Fields) {
+	l.logger.Warn(msg, mapToFields(fields)...)
+}
+
 // WarnMsg log error message with warn level.
 func (l *zapLogger) WarnMsg(msg string, err error) {
 	l.logger.Warn(msg, zap.String("error", err.Error()))
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+)
+
+var (
+	// ErrLocked is returned when another process holds the migration lock
+	// for longer than Options.LockTimeout.
+	ErrLocked = errors.New("migrate: another migration is running")
+	// ErrDirty is returned while a migration that failed on a database
+	// without transactional DDL is left partly run, see Migrator.Force.
+	ErrDirty = errors.New("migrate: a failed migration left the database dirty")
+)
+
+// dialect holds the SQL differing between drivers.
+type dialect struct {
+	// placeholder returns the bind variable of the n-th argument, from 1.
+	placeholder func(n int) string
+	// tableExists is a query counting the tables named by its argument.
+	tableExists string
+	// transactionalDDL is set for databases rolling back schema changes
+	// with the transaction. MySQL commits each DDL statement on its own,
+	// so a failed migration may be left partly run there.
+	transactionalDDL bool
+	// lock and unlock take and release a lock named name on conn.
+	// They are nil for databases only one process writes to.
+	lock   func(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error
+	unlock func(ctx context.Context, conn *sql.Conn, name string) error
+}
+
+var dialects = map[string]dialect{
+	config.DriverMySQL: {
+		placeholder: questionMark,
+		tableExists: "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		lock: func(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+			var ok sql.NullInt64
+			if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout.Seconds())).Scan(&ok); err != nil {
+				return err
+			}
+			if ok.Int64 != 1 {
+				return ErrLocked
+			}
+			return nil
+		},
+		unlock: func(ctx context.Context, conn *sql.Conn, name string) error {
+			_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+			return err
+		},
+	},
+	config.DriverPostgres: {
+		placeholder:      func(n int) string { return "$" + strconv.Itoa(n) },
+		tableExists:      "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1",
+		transactionalDDL: true,
+		lock: func(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey(name))
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrLocked
+			}
+			return err
+		},
+		unlock: func(ctx context.Context, conn *sql.Conn, name string) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey(name))
+			return err
+		},
+	},
+	config.DriverSQLite: {
+		placeholder:      questionMark,
+		tableExists:      "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+		transactionalDDL: true,
+	},
+}
+
+func lookupDialect(driver string) (dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return dialect{}, fmt.Errorf("migrate: unsupported driver %q", driver)
+	}
+
+	return d, nil
+}
+
+func questionMark(int) string {
+	return "?"
+}
+
+// lockKey maps a lock name to a PostgreSQL advisory lock key.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+
+	return int64(h.Sum64())
+}
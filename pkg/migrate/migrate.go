@@ -0,0 +1,549 @@
+// Package migrate applies versioned schema migrations, written in SQL
+// or Go, and records the applied versions in a table of the database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+const (
+	defaultTable       = "schema_migrations"
+	defaultLockTimeout = time.Minute
+)
+
+// Direction tells whether a Step applies or reverts its migration.
+type Direction string
+
+const (
+	Up   Direction = "up"
+	Down Direction = "down"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Options configures a Migrator.
+type Options struct {
+	// Table records the applied versions. Defaults to "schema_migrations".
+	Table string
+	// LockTimeout bounds the wait for a migration run by another process.
+	// Defaults to one minute.
+	LockTimeout time.Duration
+	// DryRun plans the steps without running them or taking the lock.
+	DryRun bool
+	// Logger, when set, logs every step.
+	Logger logger.Logger
+}
+
+// Step is a migration to apply or revert.
+type Step struct {
+	Migration
+	Direction Direction
+}
+
+// SQL returns the statements the step runs, or "" for a Go migration.
+func (s Step) SQL() string {
+	if s.Direction == Up && s.Migration.Up == nil {
+		return s.UpSQL
+	}
+	if s.Direction == Down && s.Migration.Down == nil {
+		return s.DownSQL
+	}
+
+	return ""
+}
+
+// Status describes a migration known to the Migrator, the database or both.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown is set for versions applied to the database but missing
+	// from the Migrator, e.g. by a newer release.
+	Unknown bool
+	// Dirty is set for a version whose migration failed part way on a
+	// database without transactional DDL, see Migrator.Force.
+	Dirty bool
+}
+
+// Migrator migrates one database. Only one process migrates a database
+// at a time: the others wait for a lock held by the database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	opts       Options
+	migrations []Migration
+}
+
+// New creates a Migrator for db, opened with the config.DatabaseConfig
+// driver named driver, e.g. "mysql".
+func New(db *sql.DB, driver string, opts Options) (*Migrator, error) {
+	d, err := lookupDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Table == "" {
+		opts.Table = defaultTable
+	}
+	if !identifier.MatchString(opts.Table) {
+		return nil, fmt.Errorf("migrate: invalid table name %q", opts.Table)
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = defaultLockTimeout
+	}
+
+	return &Migrator{db: db, dialect: d, opts: opts}, nil
+}
+
+// Add registers migrations, SQL or Go ones.
+func (m *Migrator) Add(migrations ...Migration) error {
+	for _, migration := range migrations {
+		if migration.Up == nil && strings.TrimSpace(migration.UpSQL) == "" {
+			return fmt.Errorf("migrate: %s has no up migration", migration)
+		}
+		for _, known := range m.migrations {
+			if known.Version == migration.Version {
+				return fmt.Errorf("migrate: version %d is used by %s and %s", migration.Version, known, migration)
+			}
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return nil
+}
+
+// AddFS registers the SQL migrations of dir in fsys, see Load.
+func (m *Migrator) AddFS(fsys fs.FS, dir, driver string) error {
+	migrations, err := Load(fsys, dir, driver)
+	if err != nil {
+		return err
+	}
+
+	return m.Add(migrations...)
+}
+
+// Up applies every pending migration, in version order.
+func (m *Migrator) Up(ctx context.Context) ([]Step, error) {
+	return m.run(ctx, func(applied map[int64]time.Time) ([]Step, error) {
+		var steps []Step
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok {
+				steps = append(steps, Step{Migration: migration, Direction: Up})
+			}
+		}
+		return steps, nil
+	})
+}
+
+// Down reverts the n last applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Step, error) {
+	return m.run(ctx, func(applied map[int64]time.Time) ([]Step, error) {
+		versions := sortedVersions(applied)
+		var steps []Step
+		for i := len(versions) - 1; i >= 0 && len(steps) < n; i-- {
+			step, err := m.downStep(versions[i])
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+		return steps, nil
+	})
+}
+
+// To migrates to version: it applies the pending migrations up to it
+// and reverts the applied ones above it.
+func (m *Migrator) To(ctx context.Context, version int64) ([]Step, error) {
+	return m.run(ctx, func(applied map[int64]time.Time) ([]Step, error) {
+		versions := sortedVersions(applied)
+		var steps []Step
+		for i := len(versions) - 1; i >= 0 && versions[i] > version; i-- {
+			step, err := m.downStep(versions[i])
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+				steps = append(steps, Step{Migration: migration, Direction: Up})
+			}
+		}
+		return steps, nil
+	})
+}
+
+// Status lists the known and the applied migrations by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dirty := make(map[int64]bool)
+	if len(applied) > 0 {
+		versions, err := m.dirty(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			dirty[version] = true
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		at, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Version: migration.Version, Name: migration.Name, Applied: ok, AppliedAt: at, Dirty: dirty[migration.Version],
+		})
+	}
+	for version, at := range applied {
+		if !known[version] {
+			statuses = append(statuses, Status{Version: version, Applied: true, AppliedAt: at, Unknown: true, Dirty: dirty[version]})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+func (m *Migrator) downStep(version int64) (Step, error) {
+	for _, migration := range m.migrations {
+		if migration.Version != version {
+			continue
+		}
+		if !migration.HasDown() {
+			return Step{}, fmt.Errorf("migrate: %s has no down migration", migration)
+		}
+		return Step{Migration: migration, Direction: Down}, nil
+	}
+
+	return Step{}, fmt.Errorf("migrate: version %d is applied but unknown", version)
+}
+
+// run plans the steps under the lock and runs them, one transaction
+// each. It returns the steps run, or planned in dry-run mode.
+func (m *Migrator) run(ctx context.Context, plan func(applied map[int64]time.Time) ([]Step, error)) (steps []Step, err error) {
+	err = m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		if !m.opts.DryRun {
+			if err := m.checkClean(ctx); err != nil {
+				return err
+			}
+		}
+		if steps, err = plan(applied); err != nil {
+			return err
+		}
+
+		for i, step := range steps {
+			m.logf("migrate %s %s", step.Direction, step.Migration)
+			if m.opts.DryRun {
+				continue
+			}
+			if err := m.apply(ctx, step); err != nil {
+				steps = steps[:i]
+				return fmt.Errorf("migrate: %s %s: %w", step.Direction, step.Migration, err)
+			}
+		}
+		return nil
+	})
+
+	return steps, err
+}
+
+// locked runs fn holding the migration lock, once the table exists.
+// In dry-run mode fn runs without them.
+func (m *Migrator) locked(ctx context.Context, fn func() error) (err error) {
+	if m.opts.DryRun {
+		return fn()
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+
+	return fn()
+}
+
+// Force clears the dirty mark a failed migration left on version once
+// it has been completed or undone by hand: version is then recorded as
+// applied or as not applied.
+func (m *Migrator) Force(ctx context.Context, version int64, applied bool) error {
+	m.logf("migrate force %d applied=%t", version, applied)
+
+	return m.locked(ctx, func() error {
+		if m.opts.DryRun {
+			return nil
+		}
+		p := m.dialect.placeholder
+		if !applied {
+			_, err := m.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.opts.Table, p(1)), version)
+			return err
+		}
+
+		result, err := m.db.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET dirty = %s WHERE version = %s", m.opts.Table, p(1), p(2)), false, version)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		var name string
+		for _, migration := range m.migrations {
+			if migration.Version == version {
+				name = migration.Name
+			}
+		}
+		return m.record(ctx, m.db, version, name, false)
+	})
+}
+
+// checkClean returns ErrDirty if a migration was left partly run.
+func (m *Migrator) checkClean(ctx context.Context) error {
+	dirty, err := m.dirty(ctx)
+	if err != nil || len(dirty) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w: version %d failed part way, complete or undo it by hand, then record it with force", ErrDirty, dirty[0])
+}
+
+// apply runs step in a transaction recording it. Without transactional
+// DDL the schema changes of a failing step are not rolled back, so the
+// step is recorded as dirty before it runs and marked clean with its
+// transaction.
+func (m *Migrator) apply(ctx context.Context, step Step) error {
+	p := m.dialect.placeholder
+	if !m.dialect.transactionalDDL {
+		var err error
+		if step.Direction == Up {
+			err = m.record(ctx, m.db, step.Version, step.Name, true)
+		} else {
+			_, err = m.db.ExecContext(ctx,
+				fmt.Sprintf("UPDATE %s SET dirty = %s WHERE version = %s", m.opts.Table, p(1), p(2)), true, step.Version)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	fn, script := step.Migration.Up, step.UpSQL
+	if step.Direction == Down {
+		fn, script = step.Migration.Down, step.DownSQL
+	}
+	if fn != nil {
+		err = fn(ctx, tx)
+	} else {
+		err = execScript(ctx, tx, script)
+	}
+	if err != nil {
+		if !m.dialect.transactionalDDL {
+			return fmt.Errorf("%w; the schema changes run before it were kept, version %d is marked dirty", err, step.Version)
+		}
+		return err
+	}
+
+	switch {
+	case step.Direction == Down:
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.opts.Table, p(1)), step.Version)
+	case m.dialect.transactionalDDL:
+		err = m.record(ctx, tx, step.Version, step.Name, false)
+	default:
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET dirty = %s WHERE version = %s", m.opts.Table, p(1), p(2)), false, step.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// record inserts version in the table.
+func (m *Migrator) record(ctx context.Context, db execer, version int64, name string, dirty bool) error {
+	p := m.dialect.placeholder
+	_, err := db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (version, name, applied_at, dirty) VALUES (%s, %s, %s, %s)", m.opts.Table, p(1), p(2), p(3), p(4)),
+		version, name, time.Now().UTC(), dirty)
+
+	return err
+}
+
+func execScript(ctx context.Context, tx *sql.Tx, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lock takes the migration lock on a connection of its own and returns
+// the func releasing it.
+func (m *Migrator) lock(ctx context.Context) (func() error, error) {
+	if m.dialect.lock == nil {
+		return func() error { return nil }, nil
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name := m.opts.Table + "_lock"
+	if err := m.dialect.lock(ctx, conn, name, m.opts.LockTimeout); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func() error {
+		// Release the lock even if ctx is done.
+		err := m.dialect.unlock(context.Background(), conn, name)
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL, dirty BOOLEAN NOT NULL DEFAULT FALSE)",
+		m.opts.Table))
+
+	return err
+}
+
+// applied returns the applied versions with their time. The table may
+// not exist yet in dry-run mode or for Status.
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	var tables int
+	if err := m.db.QueryRowContext(ctx, m.dialect.tableExists, m.opts.Table).Scan(&tables); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]time.Time)
+	if tables == 0 {
+		return applied, nil
+	}
+
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf("SELECT version, applied_at FROM %s", m.opts.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var at interface{}
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = parseTime(at)
+	}
+
+	return applied, rows.Err()
+}
+
+// dirty returns the versions marked dirty by a failed migration, in order.
+func (m *Migrator) dirty(ctx context.Context) ([]int64, error) {
+	rows, err := m.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT version FROM %s WHERE dirty = %s ORDER BY version", m.opts.Table, m.dialect.placeholder(1)), true)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// parseTime reads a TIMESTAMP scanned by any driver, including MySQL
+// without parseTime, which returns it as text.
+func parseTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case []byte:
+		return parseTime(string(v))
+	case string:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+func (m *Migrator) logf(template string, args ...interface{}) {
+	if m.opts.Logger == nil {
+		return
+	}
+	if m.opts.DryRun {
+		template = "[dry-run] " + template
+	}
+	m.opts.Logger.Infof(template, args...)
+}
+
+func sortedVersions(applied map[int64]time.Time) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	return versions
+}
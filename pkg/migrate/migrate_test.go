@@ -0,0 +1,177 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newMigrator returns a Migrator on a new SQLite database. Without
+// transactionalDDL it records steps the way it does on MySQL.
+func newMigrator(t *testing.T, transactionalDDL bool, migrations ...Migration) (*Migrator, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", t.TempDir()+"/migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	m, err := New(db, config.DriverSQLite, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.dialect.transactionalDDL = transactionalDDL
+	if err := m.Add(migrations...); err != nil {
+		t.Fatal(err)
+	}
+
+	return m, db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n == 1
+}
+
+// statuses returns the applied and dirty flags of the migrations by version.
+func statuses(t *testing.T, m *Migrator) map[int64][2]bool {
+	t.Helper()
+	list, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := make(map[int64][2]bool, len(list))
+	for _, s := range list {
+		flags[s.Version] = [2]bool{s.Applied, s.Dirty}
+	}
+
+	return flags
+}
+
+var (
+	createA = Migration{Version: 1, Name: "create_a", UpSQL: "CREATE TABLE a (id INT);", DownSQL: "DROP TABLE a;"}
+	// createB fails after creating its table.
+	createB = Migration{Version: 2, Name: "create_b", UpSQL: "CREATE TABLE b (id INT);\nINSERT INTO missing VALUES (1);"}
+)
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := newMigrator(t, true, createA, Migration{
+		Version: 2, Name: "create_b", UpSQL: "CREATE TABLE b (id INT);", DownSQL: "DROP TABLE b;",
+	})
+
+	steps, err := m.Up(ctx)
+	if err != nil || len(steps) != 2 {
+		t.Fatalf("Up = %v, %v", steps, err)
+	}
+	if !tableExists(t, db, "a") || !tableExists(t, db, "b") {
+		t.Fatal("Up did not create the tables")
+	}
+	if steps, err := m.Up(ctx); err != nil || len(steps) != 0 {
+		t.Errorf("second Up = %v, %v, want no step", steps, err)
+	}
+
+	if _, err := m.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if tableExists(t, db, "b") {
+		t.Error("Down kept table b")
+	}
+	if want := map[int64][2]bool{1: {true, false}, 2: {false, false}}; !reflect.DeepEqual(statuses(t, m), want) {
+		t.Errorf("statuses = %v, want %v", statuses(t, m), want)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	m, db := newMigrator(t, true, createA, createB)
+
+	steps, err := m.Up(context.Background())
+	if err == nil || errors.Is(err, ErrDirty) {
+		t.Fatalf("Up = %v, want the error of create_b", err)
+	}
+	if len(steps) != 1 || steps[0].Version != 1 {
+		t.Errorf("Up ran %v, want create_a only", steps)
+	}
+	if tableExists(t, db, "b") {
+		t.Error("the failed migration kept table b")
+	}
+	if want := map[int64][2]bool{1: {true, false}, 2: {false, false}}; !reflect.DeepEqual(statuses(t, m), want) {
+		t.Errorf("statuses = %v, want %v", statuses(t, m), want)
+	}
+}
+
+func TestFailedMigrationWithoutTransactionalDDL(t *testing.T) {
+	ctx := context.Background()
+	fixed := Migration{Version: 2, Name: "create_b", UpSQL: "CREATE TABLE b (id INT);"}
+
+	tests := []struct {
+		name    string
+		applied bool
+		// run is the number of steps Up runs after Force.
+		run  int
+		want map[int64][2]bool
+	}{
+		{name: "completed by hand", applied: true, run: 0, want: map[int64][2]bool{1: {true, false}, 2: {true, false}}},
+		{name: "undone by hand", applied: false, run: 1, want: map[int64][2]bool{1: {true, false}, 2: {true, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newMigrator(t, false, createA, createB)
+			if _, err := m.Up(ctx); err == nil {
+				t.Fatal("Up succeeded")
+			}
+			if want := map[int64][2]bool{1: {true, false}, 2: {true, true}}; !reflect.DeepEqual(statuses(t, m), want) {
+				t.Fatalf("statuses = %v, want %v", statuses(t, m), want)
+			}
+			if _, err := m.Up(ctx); !errors.Is(err, ErrDirty) {
+				t.Errorf("Up on a dirty database = %v, want ErrDirty", err)
+			}
+			if _, err := m.Down(ctx, 1); !errors.Is(err, ErrDirty) {
+				t.Errorf("Down on a dirty database = %v, want ErrDirty", err)
+			}
+
+			if err := m.Force(ctx, 2, tt.applied); err != nil {
+				t.Fatal(err)
+			}
+			m.migrations[1] = fixed
+			steps, err := m.Up(ctx)
+			if err != nil || len(steps) != tt.run {
+				t.Errorf("Up after Force = %v, %v, want %d steps", steps, err, tt.run)
+			}
+			if got := statuses(t, m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statuses = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailedDownWithoutTransactionalDDL(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newMigrator(t, false, createA, Migration{
+		Version: 2, Name: "create_b", UpSQL: "CREATE TABLE b (id INT);", DownSQL: "DROP TABLE b;\nDROP TABLE missing;",
+	})
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int64][2]bool{1: {true, false}, 2: {true, false}}; !reflect.DeepEqual(statuses(t, m), want) {
+		t.Fatalf("statuses after Up = %v, want %v", statuses(t, m), want)
+	}
+
+	if _, err := m.Down(ctx, 1); err == nil {
+		t.Fatal("Down succeeded")
+	}
+	if want := map[int64][2]bool{1: {true, false}, 2: {true, true}}; !reflect.DeepEqual(statuses(t, m), want) {
+		t.Errorf("statuses = %v, want %v", statuses(t, m), want)
+	}
+}
@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Func runs a Go migration in the transaction of the migration.
+type Func func(ctx context.Context, tx *sql.Tx) error
+
+// Migration is a versioned change of the schema. It runs UpSQL or Up
+// to apply the change and DownSQL or Down to revert it; the funcs win
+// over the SQL when both are set.
+type Migration struct {
+	Version int64
+	Name    string
+
+	UpSQL   string
+	DownSQL string
+	Up      Func
+	Down    Func
+}
+
+// HasDown reports whether m can be reverted.
+func (m Migration) HasDown() bool {
+	return m.Down != nil || strings.TrimSpace(m.DownSQL) != ""
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// fileName matches migration files: <version>_<name>.<up|down>[.<driver>].sql
+var fileName = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)(?:\.([a-z0-9]+))?\.sql$`)
+
+// Load reads the SQL migrations of dir in fsys, typically an embed.FS.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// e.g. 0001_create_users.up.sql. A file with a driver suffix, e.g.
+// 0001_create_users.up.postgres.sql, replaces the plain one for that
+// driver and is ignored for the others.
+func Load(fsys fs.FS, dir, driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	// specific records the directions set by a driver specific file.
+	specific := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		fileDriver := match[4]
+		if fileDriver != "" && fileDriver != driver {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by %s and %s", version, m.Name, match[2])
+		}
+
+		direction := match[1] + "." + match[3]
+		if specific[direction] {
+			continue
+		}
+		specific[direction] = fileDriver != ""
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.UpSQL = string(data)
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// splitStatements splits a SQL script into its statements. A statement
+// ends with a semicolon at the end of a line, so semicolons inside a
+// line, e.g. in string literals, are kept.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		current.WriteString(line)
+		if !strings.HasSuffix(strings.TrimSpace(line), ";") {
+			continue
+		}
+		statements = appendStatement(statements, current.String())
+		current.Reset()
+	}
+
+	return appendStatement(statements, current.String())
+}
+
+func appendStatement(statements []string, statement string) []string {
+	statement = strings.TrimSpace(statement)
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line != ";" && !strings.HasPrefix(line, "--") {
+			return append(statements, statement)
+		}
+	}
+
+	return statements
+}
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "empty", script: "", want: nil},
+		{name: "single without semicolon", script: "SELECT 1", want: []string{"SELECT 1"}},
+		{
+			name:   "several",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT);", "CREATE TABLE b (id INT);"},
+		},
+		{
+			name:   "multi-line statement",
+			script: "CREATE TABLE a (\n  id INT\n);\n",
+			want:   []string{"CREATE TABLE a (\n  id INT\n);"},
+		},
+		{
+			name:   "semicolon inside a line",
+			script: "INSERT INTO a (s) VALUES ('x;y'), ('z');\n",
+			want:   []string{"INSERT INTO a (s) VALUES ('x;y'), ('z');"},
+		},
+		{
+			name:   "comments and blank statements",
+			script: "-- create a\nCREATE TABLE a (id INT);\n\n;\n-- trailing comment\n",
+			want:   []string{"-- create a\nCREATE TABLE a (id INT);"},
+		},
+		{
+			name:   "comment before a statement",
+			script: "CREATE TABLE a (id INT);\n-- then b\nCREATE TABLE b (id INT);",
+			want:   []string{"CREATE TABLE a (id INT);", "-- then b\nCREATE TABLE b (id INT);"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.up.sql":             {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+		"migrations/0001_create_users.up.sql":          {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/0001_create_users.down.sql":        {Data: []byte("DROP TABLE users;")},
+		"migrations/0001_create_users.up.postgres.sql": {Data: []byte("CREATE TABLE users (id SERIAL);")},
+		"migrations/0001_create_users.up.sqlite.sql":   {Data: []byte("CREATE TABLE users (id INTEGER);")},
+		"migrations/README.md":                         {Data: []byte("not a migration")},
+		"migrations/archive/0003_old.up.sql":           {Data: []byte("SELECT 1;")},
+	}
+
+	tests := []struct {
+		driver string
+		want   []Migration
+	}{
+		{
+			driver: "mysql",
+			want: []Migration{
+				{Version: 1, Name: "create_users", UpSQL: "CREATE TABLE users (id INT);", DownSQL: "DROP TABLE users;"},
+				{Version: 2, Name: "add_email", UpSQL: "ALTER TABLE users ADD email TEXT;"},
+			},
+		},
+		{
+			driver: "postgres",
+			want: []Migration{
+				{Version: 1, Name: "create_users", UpSQL: "CREATE TABLE users (id SERIAL);", DownSQL: "DROP TABLE users;"},
+				{Version: 2, Name: "add_email", UpSQL: "ALTER TABLE users ADD email TEXT;"},
+			},
+		},
+		{
+			driver: "sqlite",
+			want: []Migration{
+				{Version: 1, Name: "create_users", UpSQL: "CREATE TABLE users (id INTEGER);", DownSQL: "DROP TABLE users;"},
+				{Version: 2, Name: "add_email", UpSQL: "ALTER TABLE users ADD email TEXT;"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			got, err := Load(fsys, "migrations", tt.driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "missing dir", fsys: fstest.MapFS{}},
+		{
+			name: "version used twice",
+			fsys: fstest.MapFS{
+				"migrations/0001_create_users.up.sql": {Data: []byte("SELECT 1;")},
+				"migrations/0001_create_posts.up.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys, "migrations", "mysql"); err == nil {
+				t.Error("Load succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Broker publishes the messages of the outbox. Publish may be called
+// again for a message already published, when the Relay fails to record
+// it, so consumers deduplicate messages by ID.
+type Broker interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+// Handler consumes the messages of a MemoryBroker topic.
+type Handler func(ctx context.Context, m Message) error
+
+// MemoryBroker delivers the messages to handlers of the same process,
+// for tests and single instance deployments.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe calls handler with the messages published to topic.
+func (b *MemoryBroker) Subscribe(topic string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[topic] = append(b.handlers[topic], handler)
+}
+
+// Publish calls the handlers of the topic of m in turn. The first error
+// fails the publication, which the Relay retries for every handler.
+func (b *MemoryBroker) Publish(ctx context.Context, m Message) error {
+	b.mu.RLock()
+	handlers := b.handlers[m.Topic]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fields of the Redis Stream entries written by RedisBroker.
+const (
+	FieldID            = "id"
+	FieldTopic         = "topic"
+	FieldAggregateType = "aggregateType"
+	FieldAggregateID   = "aggregateId"
+	FieldPayload       = "payload"
+	FieldHeaders       = "headers"
+	FieldCreatedAt     = "createdAt"
+)
+
+// RedisBroker appends the messages to Redis Streams, one per topic.
+type RedisBroker struct {
+	client redis.UniversalClient
+	prefix string
+	maxLen int64
+}
+
+// NewRedisBroker returns a RedisBroker writing to the streams named
+// prefix + topic, trimmed to about maxLen entries unless maxLen is 0.
+func NewRedisBroker(client redis.UniversalClient, prefix string, maxLen int64) *RedisBroker {
+	return &RedisBroker{client: client, prefix: prefix, maxLen: maxLen}
+}
+
+// Stream returns the name of the stream of topic.
+func (b *RedisBroker) Stream(topic string) string {
+	return b.prefix + topic
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, m Message) error {
+	values := map[string]interface{}{
+		FieldID:            strconv.FormatUint(m.ID, 10),
+		FieldTopic:         m.Topic,
+		FieldAggregateType: m.AggregateType,
+		FieldAggregateID:   m.AggregateID,
+		FieldPayload:       m.Payload,
+		FieldCreatedAt:     m.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if len(m.Headers) > 0 {
+		headers, err := json.Marshal(m.Headers)
+		if err != nil {
+			return err
+		}
+		values[FieldHeaders] = headers
+	}
+
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.Stream(m.Topic),
+		MaxLen: b.maxLen,
+		Approx: b.maxLen > 0,
+		Values: values,
+	}).Err()
+}
@@ -0,0 +1,128 @@
+// Package outbox publishes events reliably: services write them to the
+// outbox table in the transaction of their business data, and a Relay
+// publishes the committed ones to a Broker.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/repository"
+
+	"gorm.io/gorm"
+)
+
+// Headers of the messages set by Add from the context.
+const (
+	HeaderRequestID = "requestId"
+	HeaderTraceID   = "traceId"
+)
+
+// Message is an event of the outbox table. Messages of the same
+// aggregate are published in the order they were added.
+type Message struct {
+	ID            uint64            `json:"id" gorm:"primaryKey"`
+	Topic         string            `json:"topic"`
+	AggregateType string            `json:"aggregateType"`
+	AggregateID   string            `json:"aggregateId"`
+	Payload       []byte            `json:"payload"`
+	Headers       map[string]string `json:"headers,omitempty" gorm:"serializer:json"`
+	CreatedAt     time.Time         `json:"createdAt"`
+
+	// Delivery state, maintained by the Relay.
+	Attempts      int        `json:"-"`
+	NextAttemptAt *time.Time `json:"-"`
+	LastError     string     `json:"-"`
+	SentAt        *time.Time `json:"-"`
+	FailedAt      *time.Time `json:"-"`
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// orderingKey groups the messages published in order, "" for none.
+func (m *Message) orderingKey() string {
+	if m.AggregateID == "" {
+		return ""
+	}
+
+	return m.AggregateType + "/" + m.AggregateID
+}
+
+// Outbox adds messages to the outbox table.
+type Outbox struct {
+	repo *repository.Repository[Message]
+
+	mu       sync.RWMutex
+	onCommit []func()
+}
+
+// New returns the Outbox of the table in db.
+func New(db *gorm.DB) *Outbox {
+	return &Outbox{repo: repository.New[Message](db)}
+}
+
+// Add writes messages in the transaction of ctx, so they are published
+// if and only if it commits. See db.TxManager. The request and trace ids
+// of ctx are added to the headers of the messages, so their consumers
+// log them.
+func (o *Outbox) Add(ctx context.Context, messages ...*Message) error {
+	for _, m := range messages {
+		setHeader(m, HeaderRequestID, logger.RequestID(ctx))
+		setHeader(m, HeaderTraceID, logger.TraceID(ctx))
+		if err := o.repo.Create(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, fn := range o.onCommit {
+		fn := fn
+		db.AfterCommit(ctx, func(context.Context) { fn() })
+	}
+
+	return nil
+}
+
+// setHeader sets the header key of m to value, unless it is set or value
+// is empty.
+func setHeader(m *Message, key, value string) {
+	if value == "" || m.Headers[key] != "" {
+		return
+	}
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+}
+
+// AddEvent adds a message to topic holding event encoded in JSON, for
+// the aggregate aggregateType with the ID aggregateID, e.g. "user", "42".
+func (o *Outbox) AddEvent(ctx context.Context, topic, aggregateType, aggregateID string, event interface{}) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return o.Add(ctx, &Message{
+		Topic:         topic,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       payload,
+	})
+}
+
+// OnCommit calls fn once the transaction of every Add commits, e.g.
+// Relay.Wake to publish the messages without waiting for the next poll.
+func (o *Outbox) OnCommit(fn func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.onCommit = append(o.onCommit, fn)
+}
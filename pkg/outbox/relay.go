@@ -0,0 +1,152 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Relay publishes the messages of the outbox table to a Broker, in the
+// order they were added, and marks them sent.
+//
+// A Relay locks the batch it publishes, so the relays of several
+// instances take turns. A message failing to publish is retried with
+// backoff, holding back the following messages of its aggregate, and is
+// marked failed after the configured attempts.
+type Relay struct {
+	db     *gorm.DB
+	broker Broker
+	logger logger.Logger
+	cfg    config.OutboxConfig
+	wake   chan struct{}
+}
+
+func NewRelay(db *gorm.DB, broker Broker, logger logger.Logger, cfg config.OutboxConfig) *Relay {
+	return &Relay{
+		db:     db,
+		broker: broker,
+		logger: logger,
+		cfg:    cfg.WithDefaults(),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Wake makes a running relay poll the outbox now.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the messages of the outbox until ctx is done, polling it
+// every PollInterval or when woken.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		more, err := r.RelayBatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.logger.Errorf("outbox relay: %v", err)
+		}
+		if more && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// pendingQuery selects the messages due for publication: unsent, not
+// failed, not backed off and with no earlier message of their aggregate
+// left to publish.
+const pendingQuery = `sent_at IS NULL AND failed_at IS NULL
+	AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+	AND (aggregate_id = '' OR NOT EXISTS (
+		SELECT 1 FROM outbox_messages earlier
+		WHERE earlier.aggregate_type = outbox_messages.aggregate_type
+			AND earlier.aggregate_id = outbox_messages.aggregate_id
+			AND earlier.id < outbox_messages.id
+			AND earlier.sent_at IS NULL AND earlier.failed_at IS NULL))`
+
+// RelayBatch publishes a batch of due messages and tells whether more
+// may be due.
+func (r *Relay) RelayBatch(ctx context.Context) (more bool, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var messages []Message
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(pendingQuery, time.Now()).
+			Order("id").
+			Limit(r.cfg.BatchSize).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+
+		published := 0
+		// held are the aggregates with a message left unpublished.
+		held := make(map[string]bool)
+		for i := range messages {
+			m := &messages[i]
+			key := m.orderingKey()
+			if key != "" && held[key] {
+				continue
+			}
+
+			if publishErr := r.broker.Publish(ctx, *m); publishErr != nil {
+				held[key] = true
+				if err := r.markFailed(tx, m, publishErr); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(m).Update("sent_at", time.Now()).Error; err != nil {
+				return err
+			}
+			published++
+		}
+		// A full batch may hide more due messages, unless nothing could be
+		// published: then the broker is likely down, and the next poll
+		// retries.
+		more = len(messages) == r.cfg.BatchSize && published > 0
+
+		return nil
+	})
+
+	return more, err
+}
+
+// markFailed records a failed attempt to publish m.
+func (r *Relay) markFailed(tx *gorm.DB, m *Message, publishErr error) error {
+	attempts := m.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": publishErr.Error(),
+	}
+
+	if attempts >= r.cfg.Retry.MaxAttempts {
+		updates["failed_at"] = time.Now()
+		r.logger.Errorf("outbox: message %d to %s failed after %d attempts, giving up: %v", m.ID, m.Topic, attempts, publishErr)
+	} else {
+		wait := db.Backoff(r.cfg.Retry, attempts)
+		updates["next_attempt_at"] = time.Now().Add(wait)
+		r.logger.Warnf("outbox: message %d to %s failed, attempt %d/%d, retrying in %s: %v", m.ID, m.Topic, attempts, r.cfg.Retry.MaxAttempts, wait, publishErr)
+	}
+
+	return tx.Model(m).Updates(updates).Error
+}
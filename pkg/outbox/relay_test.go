@@ -0,0 +1,154 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// flakyBroker records the published messages and fails the topics set
+// in down.
+type flakyBroker struct {
+	mu        sync.Mutex
+	down      map[string]bool
+	published []string
+}
+
+func (b *flakyBroker) Publish(_ context.Context, m Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.down[m.Topic] {
+		return errors.New("broker down")
+	}
+	b.published = append(b.published, string(m.Payload))
+	return nil
+}
+
+func newTestRelay(t *testing.T, broker Broker, cfg config.OutboxConfig) (*Relay, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/outbox.db"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Message{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	logger := zap.NewZapLogger(&config.LoggerConfig{LogLevel: "fatal"}, &config.ServerConfig{})
+	return NewRelay(db, broker, logger, cfg), db
+}
+
+func addMessages(t *testing.T, db *gorm.DB, messages ...*Message) {
+	t.Helper()
+	for _, m := range messages {
+		if err := db.Create(m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRelayBatchBackoff(t *testing.T) {
+	broker := &flakyBroker{down: map[string]bool{"a": true}}
+	relay, db := newTestRelay(t, broker, config.OutboxConfig{
+		BatchSize: 2,
+		Retry:     config.RetryConfig{InitialInterval: time.Hour, MaxInterval: time.Hour},
+	})
+	addMessages(t, db,
+		&Message{Topic: "a", AggregateType: "user", AggregateID: "1", Payload: []byte("a1")},
+		&Message{Topic: "a", AggregateType: "user", AggregateID: "1", Payload: []byte("a2")},
+		&Message{Topic: "b", AggregateType: "user", AggregateID: "2", Payload: []byte("b1")},
+		&Message{Topic: "b", AggregateType: "user", AggregateID: "2", Payload: []byte("b2")},
+	)
+	ctx := context.Background()
+
+	// a2 waits behind a1, so the batch is a1 and b1: a1 fails, b1 is
+	// published.
+	more, err := relay.RelayBatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !more {
+		t.Error("no more after a full batch with a publication")
+	}
+
+	// The backed off a1 no longer fills the batch: b2 is reached, and a
+	// batch with nothing due ends the loop.
+	for more {
+		if more, err = relay.RelayBatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(broker.published); got != 2 || broker.published[0] != "b1" || broker.published[1] != "b2" {
+		t.Fatalf("published %v, want [b1 b2]", broker.published)
+	}
+
+	// Once due again, a1 is published before a2.
+	broker.down["a"] = false
+	if err := db.Model(&Message{}).Where("next_attempt_at IS NOT NULL").
+		Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.RelayBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.RelayBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"b1", "b2", "a1", "a2"}
+	if len(broker.published) != len(want) {
+		t.Fatalf("published %v, want %v", broker.published, want)
+	}
+	for i := range want {
+		if broker.published[i] != want[i] {
+			t.Fatalf("published %v, want %v", broker.published, want)
+		}
+	}
+}
+
+func TestRelayBatchBrokerDown(t *testing.T) {
+	broker := &flakyBroker{down: map[string]bool{"a": true}}
+	relay, db := newTestRelay(t, broker, config.OutboxConfig{
+		BatchSize: 1,
+		Retry:     config.RetryConfig{InitialInterval: time.Hour, MaxInterval: time.Hour},
+	})
+	addMessages(t, db, &Message{Topic: "a", Payload: []byte("a1")})
+
+	more, err := relay.RelayBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more {
+		t.Error("more after a full batch without publications")
+	}
+}
+
+func TestRelayBatchGivesUp(t *testing.T) {
+	broker := &flakyBroker{down: map[string]bool{"a": true}}
+	relay, db := newTestRelay(t, broker, config.OutboxConfig{
+		Retry: config.RetryConfig{MaxAttempts: 1},
+	})
+	addMessages(t, db, &Message{Topic: "a", AggregateType: "user", AggregateID: "1", Payload: []byte("a1")})
+
+	if _, err := relay.RelayBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var m Message
+	if err := db.First(&m).Error; err != nil {
+		t.Fatal(err)
+	}
+	if m.FailedAt == nil || m.Attempts != 1 || m.LastError != "broker down" {
+		t.Errorf("message after its last attempt: attempts %d, failed at %v, last error %q", m.Attempts, m.FailedAt, m.LastError)
+	}
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+)
+
+// sweepInterval is how often a MemoryLimiter drops its expired counters.
+const sweepInterval = time.Minute
+
+// MemoryLimiter is a Limiter counting in memory, for tests and as the
+// fallback of a RedisLimiter. Its limits are per instance.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	ts      time.Time
+	expires time.Time
+}
+
+type window struct {
+	// requests are the times of the requests in the window, oldest first.
+	requests []time.Time
+	expires  time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	if err := checkLimit(limit); err != nil {
+		return Result{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	if limit.Algorithm == config.RateLimitSlidingWindow {
+		return l.allowWindow(now, key, limit), nil
+	}
+
+	return l.allowBucket(now, key, limit), nil
+}
+
+func (l *MemoryLimiter) allowBucket(now time.Time, key string, limit Limit) Result {
+	capacity := float64(limit.capacity())
+	// rate is in tokens per nanosecond.
+	rate := float64(limit.Rate) / float64(limit.Period)
+
+	b := l.buckets[key]
+	if b == nil || now.After(b.expires) {
+		b = &bucket{tokens: capacity, ts: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.ts))*rate)
+	b.ts = now
+
+	result := Result{Limit: limit.capacity()}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration(math.Ceil((capacity - b.tokens) / rate))
+	b.expires = now.Add(result.Reset)
+
+	return result
+}
+
+func (l *MemoryLimiter) allowWindow(now time.Time, key string, limit Limit) Result {
+	w := l.windows[key]
+	if w == nil {
+		w = &window{}
+		l.windows[key] = w
+	}
+	start := now.Add(-limit.Period)
+	kept := 0
+	for kept < len(w.requests) && !w.requests[kept].After(start) {
+		kept++
+	}
+	w.requests = w.requests[kept:]
+
+	result := Result{Limit: limit.Rate}
+	if len(w.requests) < limit.Rate {
+		w.requests = append(w.requests, now)
+		result.Allowed = true
+	}
+	result.Remaining = limit.Rate - len(w.requests)
+	result.Reset = w.requests[0].Add(limit.Period).Sub(now)
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	w.expires = now.Add(limit.Period)
+
+	return result
+}
+
+// sweep drops the counters expired at now, every sweepInterval.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.After(b.expires) {
+			delete(l.buckets, key)
+		}
+	}
+	for key, w := range l.windows {
+		if now.After(w.expires) {
+			delete(l.windows, key)
+		}
+	}
+}
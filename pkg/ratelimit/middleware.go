@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+// The headers of the IETF RateLimit header fields draft, describing the
+// most restrictive limit applied to a request.
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+	HeaderPolicy    = "RateLimit-Policy"
+)
+
+// Identity is the authenticated identity of a request. Its empty fields
+// are unknown.
+type Identity struct {
+	User   string
+	Tenant string
+	// APIKey identifies the API key the request was authenticated with.
+	APIKey string
+}
+
+// IdentityFunc returns the identity of the request of c, as established
+// by authentication. It must not trust client supplied values such as
+// unverified headers, which would let a client pick its own counter.
+type IdentityFunc func(c echo.Context) Identity
+
+// rule is a config.RateLimitRule ready to match requests.
+type rule struct {
+	config.RateLimitRule
+	routes []route
+}
+
+// route matches the requests to a path, or its prefix, with a method.
+type route struct {
+	method string
+	path   string
+	prefix bool
+}
+
+func newRule(r config.RateLimitRule) rule {
+	compiled := rule{RateLimitRule: r}
+	for _, pattern := range r.Routes {
+		var rt route
+		if method, path, ok := strings.Cut(strings.TrimSpace(pattern), " "); ok {
+			rt.method, pattern = strings.ToUpper(method), strings.TrimSpace(path)
+		}
+		rt.path = strings.TrimSuffix(pattern, "*")
+		rt.prefix = rt.path != pattern
+		compiled.routes = append(compiled.routes, rt)
+	}
+
+	return compiled
+}
+
+// matches reports whether the rule applies to a request for path, routed
+// to the Echo route path routePath. Prefixes are matched against the
+// request path too, so that the requests under them routed elsewhere,
+// e.g. to "/:page", or to no route at all, as 404 probes, are counted.
+func (r *rule) matches(method, routePath, path string) bool {
+	if len(r.routes) == 0 {
+		return true
+	}
+	for _, rt := range r.routes {
+		if rt.method != "" && rt.method != method {
+			continue
+		}
+		if !rt.prefix && (routePath == rt.path || path == rt.path) {
+			return true
+		}
+		if rt.prefix && (strings.HasPrefix(routePath, rt.path) || strings.HasPrefix(path, rt.path)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limit returns the limit of the rule for tenant.
+func (r *rule) limit(tenant string) Limit {
+	limit := Limit{Algorithm: r.Algorithm, Rate: r.Limit, Period: r.Period, Burst: r.Burst}
+	for _, t := range r.Tenants {
+		if tenant != "" && t.Tenant == tenant {
+			limit.Rate, limit.Burst = t.Limit, t.Burst
+			break
+		}
+	}
+
+	return limit
+}
+
+// Middleware limits the rate of the requests by the rules of cfg, counted
+// with limiter, e.g. a RedisLimiter with a MemoryLimiter fallback. It
+// sets the RateLimit headers to the most restrictive limit applied to a
+// request, and rejects the requests exceeding a limit with 429 Too Many
+// Requests and Retry-After. Requests are let through when limiter fails.
+//
+// Requests are counted by user, tenant or API key as given by identity,
+// and by IP when identity is nil. The client IP is c.RealIP: configure
+// the IPExtractor of the Echo instance to trust only known proxies.
+func Middleware(limiter Limiter, cfg config.RateLimitConfig, identity IdentityFunc, logger logger.Logger) echo.MiddlewareFunc {
+	cfg = cfg.WithDefaults()
+	rules := make([]rule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		rules[i] = newRule(r)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			var id Identity
+			if identity != nil {
+				id = identity(c)
+			}
+
+			var (
+				applied       bool
+				tightest      Result
+				tightestLimit Limit
+			)
+			for i := range rules {
+				r := &rules[i]
+				if !r.matches(req.Method, c.Path(), req.URL.Path) {
+					continue
+				}
+
+				limit := r.limit(id.Tenant)
+				result, err := limiter.Allow(req.Context(), r.Name+":"+subject(c, r.Key, id), limit)
+				if err != nil {
+					logger.Errorf("ratelimit: rule %s: %v", r.Name, err)
+					continue
+				}
+				if !applied || !result.Allowed || result.Remaining < tightest.Remaining {
+					applied, tightest, tightestLimit = true, result, limit
+				}
+				if !result.Allowed {
+					break
+				}
+			}
+			if !applied {
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderLimit, strconv.Itoa(tightest.Limit))
+			header.Set(HeaderRemaining, strconv.Itoa(tightest.Remaining))
+			header.Set(HeaderReset, seconds(tightest.Reset))
+			header.Set(HeaderPolicy, fmt.Sprintf("%d;w=%s", tightestLimit.Rate, seconds(tightestLimit.Period)))
+			if !tightest.Allowed {
+				header.Set(echo.HeaderRetryAfter, seconds(tightest.RetryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// subject returns what the requests of c are counted by for key, falling
+// back to the client IP when id lacks it.
+func subject(c echo.Context, key string, id Identity) string {
+	var value string
+	switch key {
+	case config.RateLimitGlobal:
+		return key
+	case config.RateLimitByUser:
+		value = id.User
+	case config.RateLimitByAPIKey:
+		// Keep the API keys themselves out of the counter keys.
+		if id.APIKey != "" {
+			sum := sha256.Sum256([]byte(id.APIKey))
+			value = hex.EncodeToString(sum[:16])
+		}
+	case config.RateLimitByTenant:
+		value = id.Tenant
+	}
+	if value == "" {
+		key, value = config.RateLimitByIP, c.RealIP()
+	}
+
+	return key + ":" + value
+}
+
+// seconds formats d in whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+)
+
+// headerIdentity stands for an authentication middleware, with the
+// identity carried by X-Auth-* headers.
+func headerIdentity(c echo.Context) Identity {
+	return Identity{User: c.Request().Header.Get("X-Auth-User"), Tenant: c.Request().Header.Get("X-Auth-Tenant")}
+}
+
+func newTestServer(cfg config.RateLimitConfig, identity IdentityFunc) *echo.Echo {
+	logger := zap.NewZapLogger(&config.LoggerConfig{LogLevel: "fatal"}, &config.ServerConfig{})
+	e := echo.New()
+	e.Use(Middleware(NewMemoryLimiter(), cfg, identity, logger))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	return e
+}
+
+func get(e *echo.Echo, ip string, headers map[string]string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = ip + ":1234"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestMiddlewareIdentity(t *testing.T) {
+	cfg := config.RateLimitConfig{Rules: []config.RateLimitRule{{
+		Name:    "user",
+		Key:     config.RateLimitByUser,
+		Limit:   1,
+		Period:  time.Minute,
+		Tenants: []config.TenantRateLimit{{Tenant: "acme", Limit: 2}},
+	}}}
+
+	t.Run("without identity requests are counted by IP", func(t *testing.T) {
+		e := newTestServer(cfg, nil)
+		// Headers a client sets itself do not pick the counter.
+		if code := get(e, "192.0.2.1", map[string]string{"X-User-ID": "a", "X-Auth-User": "a"}); code != http.StatusOK {
+			t.Fatalf("first request: %d", code)
+		}
+		if code := get(e, "192.0.2.1", map[string]string{"X-User-ID": "b", "X-Auth-User": "b"}); code != http.StatusTooManyRequests {
+			t.Errorf("second request from the same IP: %d", code)
+		}
+	})
+
+	t.Run("authenticated users are counted apart", func(t *testing.T) {
+		e := newTestServer(cfg, headerIdentity)
+		for _, user := range []string{"a", "b"} {
+			if code := get(e, "192.0.2.1", map[string]string{"X-Auth-User": user}); code != http.StatusOK {
+				t.Errorf("user %s: %d", user, code)
+			}
+		}
+		if code := get(e, "192.0.2.1", map[string]string{"X-Auth-User": "a"}); code != http.StatusTooManyRequests {
+			t.Errorf("user a again: %d", code)
+		}
+	})
+
+	t.Run("the tenant limit follows the identity", func(t *testing.T) {
+		e := newTestServer(cfg, headerIdentity)
+		headers := map[string]string{"X-Auth-User": "a", "X-Auth-Tenant": "acme"}
+		for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			if code := get(e, "192.0.2.1", headers); code != want {
+				t.Errorf("request %d: %d, want %d", i+1, code, want)
+			}
+		}
+	})
+}
+
+func TestMiddlewareRoutes(t *testing.T) {
+	rule := func(name string, routes ...string) config.RateLimitRule {
+		return config.RateLimitRule{Name: name, Routes: routes, Key: config.RateLimitGlobal, Limit: 2, Period: time.Minute}
+	}
+	type request struct {
+		method, path string
+		want         int
+	}
+
+	tests := []struct {
+		name string
+		rule config.RateLimitRule
+		// routes are the GET routes of the server besides POST /login.
+		routes   []string
+		requests []request
+	}{
+		{
+			name:   "prefix counts requests to unknown routes",
+			rule:   rule("admin", "/admin/*"),
+			routes: []string{"/health"},
+			requests: []request{
+				{http.MethodGet, "/admin/probe", http.StatusNotFound},
+				{http.MethodGet, "/admin/.env", http.StatusNotFound},
+				{http.MethodGet, "/admin/users", http.StatusTooManyRequests},
+				{http.MethodGet, "/health", http.StatusOK},
+			},
+		},
+		{
+			// Echo routes the requests under /admin/ to /:page, which
+			// the route path alone would not match.
+			name:   "prefix counts requests routed outside it",
+			rule:   rule("admin", "/admin/*"),
+			routes: []string{"/:page"},
+			requests: []request{
+				{http.MethodGet, "/admin/probe", http.StatusOK},
+				{http.MethodGet, "/admin/users", http.StatusOK},
+				{http.MethodGet, "/admin/settings", http.StatusTooManyRequests},
+				{http.MethodGet, "/about", http.StatusOK},
+			},
+		},
+		{
+			name:   "route path shares a counter between paths",
+			rule:   rule("user", "GET /users/:id"),
+			routes: []string{"/users/:id", "/health"},
+			requests: []request{
+				{http.MethodGet, "/users/1", http.StatusOK},
+				{http.MethodGet, "/users/2", http.StatusOK},
+				{http.MethodGet, "/users/3", http.StatusTooManyRequests},
+				{http.MethodGet, "/health", http.StatusOK},
+			},
+		},
+		{
+			name: "method",
+			rule: rule("login", "POST /login"),
+			requests: []request{
+				{http.MethodPost, "/login", http.StatusOK},
+				{http.MethodGet, "/login", http.StatusMethodNotAllowed},
+				{http.MethodPost, "/login", http.StatusOK},
+				{http.MethodPost, "/login", http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:   "rule without routes",
+			rule:   rule("all"),
+			routes: []string{"/health"},
+			requests: []request{
+				{http.MethodGet, "/health", http.StatusOK},
+				{http.MethodGet, "/unknown", http.StatusNotFound},
+				{http.MethodGet, "/health", http.StatusTooManyRequests},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zap.NewZapLogger(&config.LoggerConfig{LogLevel: "fatal"}, &config.ServerConfig{})
+			e := echo.New()
+			e.Use(Middleware(NewMemoryLimiter(), config.RateLimitConfig{Rules: []config.RateLimitRule{tt.rule}}, nil, logger))
+			ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+			e.POST("/login", ok)
+			for _, route := range tt.routes {
+				e.GET(route, ok)
+			}
+
+			for i, r := range tt.requests {
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(r.method, r.path, nil))
+				if rec.Code != r.want {
+					t.Errorf("request %d, %s %s: %d, want %d", i+1, r.method, r.path, rec.Code, r.want)
+				}
+			}
+		})
+	}
+}
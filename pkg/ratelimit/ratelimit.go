@@ -0,0 +1,98 @@
+// Package ratelimit limits the rate of requests with a token bucket or a
+// sliding window, counted in Redis so the limits hold across instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+// Limit allows Rate requests per Period. With the token bucket
+// algorithm, Burst requests, Rate when zero, may be made at once.
+type Limit struct {
+	Algorithm string
+	Rate      int
+	Period    time.Duration
+	Burst     int
+}
+
+// capacity returns the number of requests that may be made at once.
+func (l Limit) capacity() int {
+	if l.Algorithm == config.RateLimitTokenBucket && l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Rate
+}
+
+// Result is the outcome of counting a request against a Limit.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests that may be made at once.
+	Limit int
+	// Remaining is the number of requests that may still be made now.
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed,
+	// zero if it is allowed now.
+	RetryAfter time.Duration
+	// Reset is how long until the limit is fully available again.
+	Reset time.Duration
+}
+
+// Limiter counts requests against limits.
+type Limiter interface {
+	// Allow counts a request identified by key against limit.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+func checkLimit(limit Limit) error {
+	switch limit.Algorithm {
+	case config.RateLimitTokenBucket, config.RateLimitSlidingWindow:
+	default:
+		return fmt.Errorf("ratelimit: unknown algorithm %q", limit.Algorithm)
+	}
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return fmt.Errorf("ratelimit: invalid limit %d per %s", limit.Rate, limit.Period)
+	}
+
+	return nil
+}
+
+// fallbackLimiter is a Limiter counting with fallback while primary fails.
+type fallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	logger   logger.Logger
+	// degraded is set while primary fails.
+	degraded int32
+}
+
+// WithFallback returns a Limiter counting with primary, or with fallback
+// when primary fails, e.g. a MemoryLimiter while Redis is unavailable.
+// The switches between them are logged to logger if set.
+func WithFallback(primary, fallback Limiter, logger logger.Logger) Limiter {
+	return &fallbackLimiter{primary: primary, fallback: fallback, logger: logger}
+}
+
+func (f *fallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	result, err := f.primary.Allow(ctx, key, limit)
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&f.degraded, 1, 0) && f.logger != nil {
+			f.logger.Info("ratelimit: primary limiter recovered")
+		}
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return result, err
+	}
+
+	if atomic.CompareAndSwapInt32(&f.degraded, 0, 1) && f.logger != nil {
+		f.logger.Warnf("ratelimit: primary limiter failed, counting with the fallback: %v", err)
+	}
+	return f.fallback.Allow(ctx, key, limit)
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+)
+
+// The scripts take the time from the Redis server, so the instances
+// counting the same key agree on it, and return {allowed, remaining,
+// retry after, reset} with the durations in milliseconds.
+
+// tokenBucketScript takes a token from the bucket KEYS[1], a hash of its
+// tokens and the time they were counted, holding up to ARGV[1] tokens
+// and refilled with ARGV[2] tokens per millisecond.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((capacity - tokens) / rate)
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// slidingWindowScript adds the request ARGV[3] to the log KEYS[1], a
+// sorted set of the requests by time, if it holds less than ARGV[1]
+// requests of the last ARGV[2] milliseconds.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + tonumber(time[2]) / 1000
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local reset = math.ceil(tonumber(oldest[2]) + window - now)
+local retry = 0
+if allowed == 0 then
+	retry = reset
+end
+return {allowed, limit - count, retry, reset}
+`)
+
+// RedisLimiter is a Limiter counting in Redis, atomically with Lua
+// scripts, so the limits are shared by the instances of a service.
+type RedisLimiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisLimiter returns a RedisLimiter keeping its counters in client
+// under keys starting with prefix.
+func NewRedisLimiter(client redis.UniversalClient, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := checkLimit(limit); err != nil {
+		return Result{}, err
+	}
+
+	var (
+		reply []int64
+		err   error
+	)
+	key = l.prefix + key
+	periodMs := float64(limit.Period.Milliseconds())
+	switch limit.Algorithm {
+	case config.RateLimitTokenBucket:
+		rate := float64(limit.Rate) / periodMs
+		reply, err = tokenBucketScript.Run(ctx, l.client, []string{key}, limit.capacity(), rate).Int64Slice()
+	case config.RateLimitSlidingWindow:
+		var id string
+		if id, err = requestID(); err != nil {
+			return Result{}, err
+		}
+		reply, err = slidingWindowScript.Run(ctx, l.client, []string{key}, limit.Rate, periodMs, id).Int64Slice()
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: %w", err)
+	}
+	if len(reply) != 4 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+
+	return Result{
+		Allowed:    reply[0] == 1,
+		Limit:      limit.capacity(),
+		Remaining:  int(reply[1]),
+		RetryAfter: time.Duration(reply[2]) * time.Millisecond,
+		Reset:      time.Duration(reply[3]) * time.Millisecond,
+	}, nil
+}
+
+// requestID returns a random member of a sliding window log.
+func requestID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ratelimit: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
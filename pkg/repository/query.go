@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 1000
+)
+
+// Op is the comparison of a Filter.
+type Op string
+
+const (
+	OpEq      Op = "eq"
+	OpNe      Op = "ne"
+	OpGt      Op = "gt"
+	OpGte     Op = "gte"
+	OpLt      Op = "lt"
+	OpLte     Op = "lte"
+	OpIn      Op = "in"
+	OpLike    Op = "like"
+	OpNull    Op = "null"
+	OpNotNull Op = "notNull"
+)
+
+// Filter compares a field of the model, named by its Go name in any case
+// or its column name, with Value. The Value of an OpIn filter is a slice
+// or an array of any element type, e.g. []int64{1, 2}.
+type Filter struct {
+	Field string
+	Op    Op
+	Value interface{}
+}
+
+// Eq matches the rows whose field is equal to value.
+func Eq(field string, value interface{}) Filter {
+	return Filter{Field: field, Op: OpEq, Value: value}
+}
+
+// Ne matches the rows whose field is not equal to value.
+func Ne(field string, value interface{}) Filter {
+	return Filter{Field: field, Op: OpNe, Value: value}
+}
+
+// Gt matches the rows whose field is greater than value.
+func Gt(field string, value interface{}) Filter {
+	return Filter{Field: field, Op: OpGt, Value: value}
+}
+
+// Gte matches the rows whose field is greater than or equal to value.
+func Gte(field string, value interface{}) Filter {
+	return Filter{Field: field, Op: OpGte, Value: value}
+}
+
+// Lt matches the rows whose field is less than value.
+func Lt(field string, value interface{}) Filter {
+	return Filter{Field: field, Op: OpLt, Value: value}
+}
+
+// Lte matches the rows whose field is less than or equal to value.
+func Lte(field string, value interface{}) Filter {
+	return Filter{Field: field, Op: OpLte, Value: value}
+}
+
+// In matches the rows whose field is one of values.
+func In(field string, values ...interface{}) Filter {
+	return Filter{Field: field, Op: OpIn, Value: values}
+}
+
+// Like matches the rows whose field matches the SQL LIKE pattern.
+func Like(field, pattern string) Filter {
+	return Filter{Field: field, Op: OpLike, Value: pattern}
+}
+
+// IsNull and NotNull match the rows whose field is, or is not, NULL.
+func IsNull(field string) Filter  { return Filter{Field: field, Op: OpNull} }
+func NotNull(field string) Filter { return Filter{Field: field, Op: OpNotNull} }
+
+// Sort orders the rows by a field, named as in Filter.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+func Asc(field string) Sort  { return Sort{Field: field} }
+func Desc(field string) Sort { return Sort{Field: field, Desc: true} }
+
+// Query selects the rows of List and ListAfter. Filters are ANDed.
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	// Limit is the page size, 20 by default and at most 1000.
+	Limit int
+	// Offset skips rows in List. ListAfter ignores it.
+	Offset int
+	// WithDeleted includes the soft deleted rows.
+	WithDeleted bool
+}
+
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return defaultLimit
+	case q.Limit > maxLimit:
+		return maxLimit
+	}
+
+	return q.Limit
+}
+
+// Page is a page of rows.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Total counts the rows matching the query, set by List.
+	Total int64 `json:"total,omitempty"`
+	// NextCursor continues a ListAfter; empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+func column(field *schema.Field) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+}
+
+// condition returns the clause of f, for the fields of s.
+func condition(s *schema.Schema, f Filter) (clause.Expression, error) {
+	field, err := lookUpField(s, f.Field)
+	if err != nil {
+		return nil, err
+	}
+	col := column(field)
+
+	switch f.Op {
+	case OpEq:
+		return clause.Eq{Column: col, Value: f.Value}, nil
+	case OpNe:
+		return clause.Neq{Column: col, Value: f.Value}, nil
+	case OpGt:
+		return clause.Gt{Column: col, Value: f.Value}, nil
+	case OpGte:
+		return clause.Gte{Column: col, Value: f.Value}, nil
+	case OpLt:
+		return clause.Lt{Column: col, Value: f.Value}, nil
+	case OpLte:
+		return clause.Lte{Column: col, Value: f.Value}, nil
+	case OpIn:
+		values, ok := inValues(f.Value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s filter on %s needs a list of values", ErrInvalidQuery, f.Op, f.Field)
+		}
+		return clause.IN{Column: col, Values: values}, nil
+	case OpLike:
+		return clause.Like{Column: col, Value: f.Value}, nil
+	case OpNull:
+		return clause.Eq{Column: col, Value: nil}, nil
+	case OpNotNull:
+		return clause.Neq{Column: col, Value: nil}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown filter operator %q", ErrInvalidQuery, f.Op)
+}
+
+// inValues returns the elements of value, a slice or an array of any
+// type. A []byte is a single value, not a list.
+func inValues(value interface{}) ([]interface{}, bool) {
+	if values, ok := value.([]interface{}); ok {
+		return values, true
+	}
+	if _, ok := value.([]byte); ok {
+		return nil, false
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+
+	return values, true
+}
+
+// lookUpField returns the column field of s named name, its Go name in
+// any case, e.g. "createdAt", or its column name.
+func lookUpField(s *schema.Schema, name string) (*schema.Field, error) {
+	field := s.LookUpField(name)
+	if field == nil {
+		for _, f := range s.Fields {
+			if strings.EqualFold(f.Name, name) {
+				field = f
+				break
+			}
+		}
+	}
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("%w: %s has no field %q", ErrInvalidQuery, s.Name, name)
+	}
+
+	return field, nil
+}
+
+// keyset is the sort of a ListAfter, ending with the primary key so that
+// every row has a distinct position.
+type keyset struct {
+	fields []*schema.Field
+	desc   []bool
+}
+
+func newKeyset(s *schema.Schema, sorts []Sort) (keyset, error) {
+	var k keyset
+	hasPrimaryKey := false
+	for _, sort := range sorts {
+		field, err := lookUpField(s, sort.Field)
+		if err != nil {
+			return keyset{}, err
+		}
+		k.fields = append(k.fields, field)
+		k.desc = append(k.desc, sort.Desc)
+		hasPrimaryKey = hasPrimaryKey || field == s.PrioritizedPrimaryField
+	}
+	if !hasPrimaryKey {
+		k.fields = append(k.fields, s.PrioritizedPrimaryField)
+		k.desc = append(k.desc, false)
+	}
+
+	return k, nil
+}
+
+func (k keyset) orderBy() clause.OrderBy {
+	var orderBy clause.OrderBy
+	for i, field := range k.fields {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: column(field), Desc: k.desc[i]})
+	}
+
+	return orderBy
+}
+
+// after returns the condition matching the rows after the cursor values:
+// (a > va) OR (a = va AND b > vb) OR ..., with < for descending fields.
+func (k keyset) after(values []interface{}) clause.Expression {
+	var or []clause.Expression
+	for i, field := range k.fields {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: column(k.fields[j]), Value: values[j]})
+		}
+		if k.desc[i] {
+			and = append(and, clause.Lt{Column: column(field), Value: values[i]})
+		} else {
+			and = append(and, clause.Gt{Column: column(field), Value: values[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	if len(or) == 1 {
+		return or[0]
+	}
+
+	// Wrap the disjunction, which gorm would otherwise OR with the
+	// conditions before it.
+	return clause.And(clause.Or(or...))
+}
+
+// encode returns the cursor of the position of row, a struct value.
+func (k keyset) encode(ctx context.Context, row reflect.Value) (string, error) {
+	values := make([]interface{}, len(k.fields))
+	for i, field := range k.fields {
+		values[i], _ = field.ValueOf(ctx, row)
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decode returns the values of cursor, typed as the keyset fields.
+func (k keyset) decode(cursor string) ([]interface{}, error) {
+	invalid := fmt.Errorf("%w: invalid cursor %q", ErrInvalidQuery, cursor)
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw) != len(k.fields) {
+		return nil, invalid
+	}
+
+	values := make([]interface{}, len(raw))
+	for i, field := range k.fields {
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(raw[i], value.Interface()); err != nil {
+			return nil, invalid
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	return values, nil
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type item struct {
+	ID        uint
+	Email     string
+	Score     int
+	DeletedAt gorm.DeletedAt
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a new database.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	return db
+}
+
+func TestKeysetSQL(t *testing.T) {
+	db := openTestDB(t)
+	repo := New[item](db)
+	s, err := repo.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sort   []Sort
+		values []interface{}
+		want   string
+	}{
+		{
+			name:   "primary key",
+			values: []interface{}{uint(5)},
+			want: "SELECT * FROM `items` WHERE `items`.`email` = \"a@b\" AND `items`.`id` > 5 " +
+				"AND `items`.`deleted_at` IS NULL ORDER BY `items`.`id`",
+		},
+		{
+			name:   "descending field",
+			sort:   []Sort{Desc("score")},
+			values: []interface{}{10, uint(5)},
+			want: "SELECT * FROM `items` WHERE `items`.`email` = \"a@b\" AND " +
+				"(`items`.`score` < 10 OR (`items`.`score` = 10 AND `items`.`id` > 5)) " +
+				"AND `items`.`deleted_at` IS NULL ORDER BY `items`.`score` DESC,`items`.`id`",
+		},
+		{
+			name:   "primary key sorted descending",
+			sort:   []Sort{Asc("email"), Desc("id")},
+			values: []interface{}{"a@b", uint(5)},
+			want: "SELECT * FROM `items` WHERE `items`.`email` = \"a@b\" AND " +
+				"(`items`.`email` > \"a@b\" OR (`items`.`email` = \"a@b\" AND `items`.`id` < 5)) " +
+				"AND `items`.`deleted_at` IS NULL ORDER BY `items`.`email`,`items`.`id` DESC",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := newKeyset(s, tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, err := condition(s, Eq("email", "a@b"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.Model(&item{}).Where(filter).Where(keys.after(tt.values)).
+					Clauses(keys.orderBy()).Find(&[]item{})
+			})
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListAfterKeepsFilters(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := New[item](db)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		email := "other@example.com"
+		if i%2 == 0 {
+			email = "a@example.com"
+		}
+		if err := repo.Create(ctx, &item{Email: email, Score: i % 3}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range [][]Sort{nil, {Desc("score")}} {
+		q := Query{Filters: []Filter{Eq("email", "a@example.com")}, Sort: sort, Limit: 2}
+		var ids []uint
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatal("ListAfter does not end")
+			}
+			page, err := repo.ListAfter(ctx, q, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, it := range page.Items {
+				if it.Email != "a@example.com" {
+					t.Errorf("sort %v: row %d does not match the filter", sort, it.ID)
+				}
+				ids = append(ids, it.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if len(ids) != 5 {
+			t.Errorf("sort %v: got rows %v, want the 5 matching rows", sort, ids)
+		}
+	}
+}
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	s, err := New[item](db).Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := newKeyset(s, []Sort{Desc("score")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := keys.encode(context.Background(), reflect.ValueOf(item{ID: 7, Score: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := keys.decode(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != 3 || values[1] != uint(7) {
+		t.Errorf("decode(encode) = %v, want [3 7]", values)
+	}
+
+	for _, bad := range []string{"!", "W10", "WzFd"} {
+		if _, err := keys.decode(bad); err == nil {
+			t.Errorf("decode(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestInFilter(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := New[item](db)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if err := repo.Create(ctx, &item{Email: string(rune('a'+i)) + "@example.com", Score: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int64
+	}{
+		{name: "variadic", filter: In("score", 1, 3), want: 2},
+		{name: "interface slice", filter: Filter{Field: "score", Op: OpIn, Value: []interface{}{0, 1, 2}}, want: 3},
+		{name: "int slice", filter: Filter{Field: "score", Op: OpIn, Value: []int{4}}, want: 1},
+		{name: "string slice", filter: Filter{Field: "email", Op: OpIn, Value: []string{"a@example.com", "e@example.com", "z@example.com"}}, want: 2},
+		{name: "array", filter: Filter{Field: "score", Op: OpIn, Value: [2]int64{0, 4}}, want: 2},
+		{name: "empty", filter: Filter{Field: "score", Op: OpIn, Value: []int{}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := repo.Count(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.want {
+				t.Errorf("Count = %d, want %d", n, tt.want)
+			}
+		})
+	}
+
+	for _, value := range []interface{}{1, "a@example.com", []byte("a@example.com"), nil} {
+		if _, err := repo.Count(ctx, Filter{Field: "email", Op: OpIn, Value: value}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("in filter on %#v = %v, want ErrInvalidQuery", value, err)
+		}
+	}
+}
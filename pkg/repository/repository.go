@@ -0,0 +1,365 @@
+// Package repository provides Repository, the CRUD operations of a gorm
+// model that domain repositories embed.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrNotFound is returned when no row has the given primary key.
+	ErrNotFound = errors.New("repository: not found")
+	// ErrConflict is returned by Update when the row was updated since
+	// it was read, i.e. its version changed.
+	ErrConflict = errors.New("repository: version conflict")
+	// ErrInvalidQuery wraps the errors of filters, sorts and cursors
+	// naming unknown fields or malformed.
+	ErrInvalidQuery = errors.New("repository: invalid query")
+	// ErrNoSoftDelete is returned by Restore for models without a
+	// gorm.DeletedAt field.
+	ErrNoSoftDelete = errors.New("repository: model is not soft deleted")
+)
+
+// versionField is the field of the models locked optimistically.
+const versionField = "Version"
+
+// Repository implements the common operations on the model T, a struct
+// mapped by gorm with a single primary key:
+//   - a gorm.DeletedAt field makes Delete soft, undone by Restore;
+//   - an integer Version field makes Update check and increment it, so
+//     concurrent updates of a row fail with ErrConflict.
+//
+// Every operation runs in the transaction of its context, if any; see
+// db.TxManager.
+type Repository[T any] struct {
+	db *gorm.DB
+
+	once      sync.Once
+	schema    *schema.Schema
+	schemaErr error
+}
+
+// New returns the Repository of T on db.
+func New[T any](db *gorm.DB) *Repository[T] {
+	return &Repository[T]{db: db}
+}
+
+// Schema returns the gorm schema of T.
+func (r *Repository[T]) Schema() (*schema.Schema, error) {
+	r.once.Do(func() {
+		stmt := &gorm.Statement{DB: r.db}
+		if r.schemaErr = stmt.Parse(new(T)); r.schemaErr != nil {
+			return
+		}
+		r.schema = stmt.Schema
+		if r.schema.PrioritizedPrimaryField == nil {
+			r.schemaErr = fmt.Errorf("repository: %s has no single primary key", r.schema.Name)
+		}
+	})
+
+	return r.schema, r.schemaErr
+}
+
+// DB returns the gorm DB of ctx on the table of T, for the queries
+// Repository does not cover.
+func (r *Repository[T]) DB(ctx context.Context) *gorm.DB {
+	return db.Conn(ctx, r.db).Model(new(T))
+}
+
+// Get returns the row of T with the primary key id.
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	s, err := r.Schema()
+	if err != nil {
+		return nil, err
+	}
+
+	entity := new(T)
+	err = db.Conn(ctx, r.db).Where(clause.Eq{Column: column(s.PrioritizedPrimaryField), Value: id}).Take(entity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// List returns the page of rows matching q at q.Offset, with their total.
+func (r *Repository[T]) List(ctx context.Context, q Query) (Page[T], error) {
+	s, err := r.Schema()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	tx, err := r.query(ctx, s, q)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	var page Page[T]
+	if err := tx.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return Page[T]{}, err
+	}
+	for _, sort := range q.Sort {
+		field, err := lookUpField(s, sort.Field)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		tx = tx.Order(clause.OrderByColumn{Column: column(field), Desc: sort.Desc})
+	}
+	// A stable order keeps the pages from overlapping.
+	tx = tx.Order(clause.OrderByColumn{Column: column(s.PrioritizedPrimaryField)})
+
+	page.Items = make([]T, 0, q.limit())
+	if err := tx.Limit(q.limit()).Offset(q.Offset).Find(&page.Items).Error; err != nil {
+		return Page[T]{}, err
+	}
+
+	return page, nil
+}
+
+// ListAfter returns the page of rows matching q following cursor, the
+// NextCursor of the previous page or "" for the first one. Unlike List
+// it does not skip rows, so it stays fast and consistent deep into a
+// table being written to. The sort fields must not be NULL.
+func (r *Repository[T]) ListAfter(ctx context.Context, q Query, cursor string) (Page[T], error) {
+	s, err := r.Schema()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	tx, err := r.query(ctx, s, q)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	keys, err := newKeyset(s, q.Sort)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	if cursor != "" {
+		values, err := keys.decode(cursor)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		tx = tx.Where(keys.after(values))
+	}
+
+	// One more row tells whether there is a next page.
+	limit := q.limit()
+	var page Page[T]
+	page.Items = make([]T, 0, limit+1)
+	if err := tx.Clauses(keys.orderBy()).Limit(limit + 1).Find(&page.Items).Error; err != nil {
+		return Page[T]{}, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		if page.NextCursor, err = keys.encode(ctx, reflect.ValueOf(&page.Items[limit-1]).Elem()); err != nil {
+			return Page[T]{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// Count returns the number of rows matching filters.
+func (r *Repository[T]) Count(ctx context.Context, filters ...Filter) (int64, error) {
+	s, err := r.Schema()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := r.query(ctx, s, Query{Filters: filters})
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = tx.Count(&count).Error
+
+	return count, err
+}
+
+// Exists reports whether a row matches filters.
+func (r *Repository[T]) Exists(ctx context.Context, filters ...Filter) (bool, error) {
+	s, err := r.Schema()
+	if err != nil {
+		return false, err
+	}
+	tx, err := r.query(ctx, s, Query{Filters: filters})
+	if err != nil {
+		return false, err
+	}
+
+	var found []int
+	if err := tx.Select("1").Limit(1).Scan(&found).Error; err != nil {
+		return false, err
+	}
+
+	return len(found) > 0, nil
+}
+
+// Create inserts entity, setting its primary key if generated.
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	return db.Conn(ctx, r.db).Create(entity).Error
+}
+
+// Update saves every field of entity, except its creation time. When T
+// has a Version field, the row is only updated if its version is still
+// the one of entity, else ErrConflict is returned; on success the
+// version of entity is incremented.
+func (r *Repository[T]) Update(ctx context.Context, entity *T) error {
+	s, err := r.Schema()
+	if err != nil {
+		return err
+	}
+
+	tx := db.Conn(ctx, r.db).Model(entity).Select("*").Omit(r.readOnlyFields(s)...)
+	value := reflect.ValueOf(entity).Elem()
+	version := s.LookUpField(versionField)
+	var previous int64
+	if version != nil {
+		previous, err = versionOf(ctx, version, value)
+		if err != nil {
+			return err
+		}
+		tx = tx.Where(clause.Eq{Column: column(version), Value: previous})
+		if err := version.Set(ctx, value, previous+1); err != nil {
+			return err
+		}
+	}
+
+	result := tx.Updates(entity)
+	if result.Error == nil && result.RowsAffected > 0 {
+		return nil
+	}
+	if version != nil {
+		_ = version.Set(ctx, value, previous)
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// No row changed: either there is none, or it is stale, or it is
+	// equal to entity on drivers reporting changed rows only.
+	id, _ := s.PrioritizedPrimaryField.ValueOf(ctx, value)
+	exists, err := r.Exists(ctx, Filter{Field: s.PrioritizedPrimaryField.Name, Op: OpEq, Value: id})
+	switch {
+	case err != nil:
+		return err
+	case !exists:
+		return ErrNotFound
+	case version != nil:
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// readOnlyFields returns the fields Update keeps.
+func (r *Repository[T]) readOnlyFields(s *schema.Schema) []string {
+	fields := []string{s.PrioritizedPrimaryField.Name}
+	for _, field := range s.Fields {
+		if field.AutoCreateTime != 0 || isDeletedAt(field) {
+			fields = append(fields, field.Name)
+		}
+	}
+
+	return fields
+}
+
+// Delete deletes the row of T with the primary key id, softly if T has
+// a gorm.DeletedAt field.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) error {
+	s, err := r.Schema()
+	if err != nil {
+		return err
+	}
+
+	result := db.Conn(ctx, r.db).Where(clause.Eq{Column: column(s.PrioritizedPrimaryField), Value: id}).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Restore undoes the soft Delete of the row of T with the primary key id.
+func (r *Repository[T]) Restore(ctx context.Context, id interface{}) error {
+	s, err := r.Schema()
+	if err != nil {
+		return err
+	}
+	deletedAt := deletedAtField(s)
+	if deletedAt == nil {
+		return ErrNoSoftDelete
+	}
+
+	result := db.Conn(ctx, r.db).Unscoped().Model(new(T)).
+		Where(clause.Eq{Column: column(s.PrioritizedPrimaryField), Value: id}).
+		Where(clause.Neq{Column: column(deletedAt), Value: nil}).
+		Update(deletedAt.DBName, nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// query returns the DB selecting the rows of T matching the filters of q.
+func (r *Repository[T]) query(ctx context.Context, s *schema.Schema, q Query) (*gorm.DB, error) {
+	tx := db.Conn(ctx, r.db).Model(new(T))
+	if q.WithDeleted {
+		tx = tx.Unscoped()
+	}
+	for _, filter := range q.Filters {
+		cond, err := condition(s, filter)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(cond)
+	}
+
+	return tx, nil
+}
+
+func versionOf(ctx context.Context, field *schema.Field, value reflect.Value) (int64, error) {
+	v := field.ReflectValueOf(ctx, value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	}
+
+	return 0, fmt.Errorf("repository: %s.%s must be an integer", field.Schema.Name, field.Name)
+}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+func isDeletedAt(field *schema.Field) bool {
+	return field.FieldType == deletedAtType
+}
+
+func deletedAtField(s *schema.Schema) *schema.Field {
+	for _, field := range s.Fields {
+		if isDeletedAt(field) {
+			return field
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/constants"
+
+	"gopkg.in/yaml.v3"
+)
+
+// refPrefix starts the values referencing a row, as in "@users.alice";
+// "@@" escapes a literal "@".
+const refPrefix = "@"
+
+// Fixtures holds rows by table and label: fixtures["users"]["alice"] is
+// the row labelled alice of the model registered as users, as a map of
+// its fields, named by Go name in any case or column name.
+type Fixtures map[string]map[string]map[string]interface{}
+
+// Merge adds the rows of other to f, replacing the rows with the same
+// table and label.
+func (f Fixtures) Merge(other Fixtures) {
+	for table, rows := range other {
+		if f[table] == nil {
+			f[table] = make(map[string]map[string]interface{}, len(rows))
+		}
+		for label, row := range rows {
+			f[table][label] = row
+		}
+	}
+}
+
+// ReadFiles reads the fixture files of fsys matching patterns, in YAML
+// or JSON according to their extension, and merges them in order.
+func ReadFiles(fsys fs.FS, patterns ...string) (Fixtures, error) {
+	fixtures := make(Fixtures)
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("seed: no fixture file matches %q", pattern)
+		}
+		for _, file := range files {
+			fileFixtures, err := readFile(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("seed: %s: %w", file, err)
+			}
+			fixtures.Merge(fileFixtures)
+		}
+	}
+
+	return fixtures, nil
+}
+
+func readFile(fsys fs.FS, file string) (Fixtures, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures Fixtures
+	switch strings.TrimPrefix(path.Ext(file), ".") {
+	case constants.Yaml, constants.Yml:
+		err = yaml.Unmarshal(data, &fixtures)
+	case constants.Json:
+		err = json.Unmarshal(data, &fixtures)
+	default:
+		err = fmt.Errorf("unsupported fixture format %q", path.Ext(file))
+	}
+
+	return fixtures, err
+}
+
+// rowRef identifies a row of the fixtures.
+type rowRef struct {
+	table, label string
+}
+
+func (r rowRef) String() string {
+	return r.table + "." + r.label
+}
+
+// parseRef returns the row value references, if it is a reference.
+func parseRef(value interface{}) (rowRef, bool, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, refPrefix) || strings.HasPrefix(s, refPrefix+refPrefix) {
+		return rowRef{}, false, nil
+	}
+
+	table, label, ok := strings.Cut(strings.TrimPrefix(s, refPrefix), ".")
+	if !ok || table == "" || label == "" {
+		return rowRef{}, false, fmt.Errorf("seed: invalid reference %q, want @table.label", s)
+	}
+
+	return rowRef{table: table, label: label}, true, nil
+}
+
+// unescape returns value with a leading "@@" turned into "@".
+func unescape(value interface{}) interface{} {
+	if s, ok := value.(string); ok && strings.HasPrefix(s, refPrefix+refPrefix) {
+		return strings.TrimPrefix(s, refPrefix)
+	}
+
+	return value
+}
+
+// order returns the rows of fixtures so that every row comes after the
+// rows it references, in table and label order otherwise.
+func (f Fixtures) order() ([]rowRef, error) {
+	var refs []rowRef
+	for _, table := range sortedKeys(f) {
+		for _, label := range sortedKeys(f[table]) {
+			refs = append(refs, rowRef{table: table, label: label})
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[rowRef]int, len(refs))
+	ordered := make([]rowRef, 0, len(refs))
+	var visit func(ref rowRef, path []rowRef) error
+	visit = func(ref rowRef, path []rowRef) error {
+		switch state[ref] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("seed: reference cycle %s", formatPath(append(path, ref)))
+		}
+		state[ref] = visiting
+
+		row := f[ref.table][ref.label]
+		for _, field := range sortedKeys(row) {
+			target, ok, err := parseRef(row[field])
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", ref, field, err)
+			}
+			if !ok {
+				continue
+			}
+			if _, exists := f[target.table][target.label]; !exists {
+				return fmt.Errorf("seed: %s.%s references unknown row %s", ref, field, target)
+			}
+			if err := visit(target, append(path, ref)); err != nil {
+				return err
+			}
+		}
+
+		state[ref] = done
+		ordered = append(ordered, ref)
+		return nil
+	}
+
+	for _, ref := range refs {
+		if err := visit(ref, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+func formatPath(path []rowRef) string {
+	names := make([]string, len(path))
+	for i, ref := range path {
+		names[i] = ref.String()
+	}
+
+	return strings.Join(names, " -> ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
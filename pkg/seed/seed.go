@@ -0,0 +1,295 @@
+// Package seed loads fixtures, datasets described in YAML or JSON, into
+// the database of dev and test environments.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/constants"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrProduction is returned by New in the prod mode.
+var ErrProduction = errors.New("seed: refusing to seed a prod database")
+
+// Strategy tells how Load treats the rows already in the tables.
+type Strategy string
+
+const (
+	// Upsert updates the rows matching a fixture by its key fields and
+	// inserts the others, so loading the same fixtures twice is a no-op.
+	Upsert Strategy = "upsert"
+	// Truncate deletes every row of the fixture tables, soft deleted ones
+	// included, before inserting the fixtures.
+	Truncate Strategy = "truncate"
+)
+
+// Options configures a Seeder.
+type Options struct {
+	// Mode is the ServerConfig.Mode of the service. Seeding is refused
+	// in prod.
+	Mode string
+	// Strategy defaults to Upsert.
+	Strategy Strategy
+}
+
+// Result counts the rows changed by Load and holds the loaded rows.
+type Result struct {
+	Inserted int
+	Updated  int
+	Deleted  int64
+
+	rows map[rowRef]interface{}
+}
+
+// Row returns the row loaded for table and label, a pointer to its
+// model with its primary key set, or nil.
+func (r *Result) Row(table, label string) interface{} {
+	return r.rows[rowRef{table: table, label: label}]
+}
+
+// Seeder loads fixtures into registered models.
+type Seeder struct {
+	db     *gorm.DB
+	opts   Options
+	models map[string]*model
+}
+
+type model struct {
+	schema *schema.Schema
+	// keys identify the row of a fixture in Upsert.
+	keys []*schema.Field
+}
+
+// CheckMode returns ErrProduction if mode, a ServerConfig.Mode or the
+// environment of a config.Loader, forbids seeding.
+func CheckMode(mode string) error {
+	if strings.EqualFold(mode, constants.EnvProd) {
+		return ErrProduction
+	}
+
+	return nil
+}
+
+// field returns the column field named name, its Go name in any case,
+// e.g. "authorId", or its column name.
+func (m *model) field(name string) (*schema.Field, error) {
+	field := m.schema.LookUpField(name)
+	if field == nil {
+		for _, f := range m.schema.Fields {
+			if strings.EqualFold(f.Name, name) {
+				field = f
+				break
+			}
+		}
+	}
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("%s has no field %q", m.schema.Name, name)
+	}
+
+	return field, nil
+}
+
+// New returns a Seeder writing to db, or ErrProduction in the prod mode.
+func New(db *gorm.DB, opts Options) (*Seeder, error) {
+	if err := CheckMode(opts.Mode); err != nil {
+		return nil, err
+	}
+	switch opts.Strategy {
+	case "":
+		opts.Strategy = Upsert
+	case Upsert, Truncate:
+	default:
+		return nil, fmt.Errorf("seed: unknown strategy %q", opts.Strategy)
+	}
+
+	return &Seeder{db: db, opts: opts, models: make(map[string]*model)}, nil
+}
+
+// Register maps the fixtures of table to value, a pointer to a gorm
+// model. Upsert matches the existing rows on keys, field names such as
+// "Email"; without keys, on the primary key if the fixture sets it and
+// on every field of the fixture otherwise.
+func (s *Seeder) Register(table string, value interface{}, keys ...string) error {
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(value); err != nil {
+		return fmt.Errorf("seed: %s: %w", table, err)
+	}
+
+	m := &model{schema: stmt.Schema}
+	for _, key := range keys {
+		field, err := m.field(key)
+		if err != nil {
+			return fmt.Errorf("seed: %w", err)
+		}
+		m.keys = append(m.keys, field)
+	}
+	s.models[table] = m
+
+	return nil
+}
+
+// Load writes fixtures in a transaction, in an order where every row is
+// inserted after the rows it references.
+func (s *Seeder) Load(ctx context.Context, fixtures Fixtures) (*Result, error) {
+	for table := range fixtures {
+		if s.models[table] == nil {
+			return nil, fmt.Errorf("seed: no model registered for %q", table)
+		}
+	}
+	order, err := fixtures.order()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{rows: make(map[rowRef]interface{}, len(order))}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if s.opts.Strategy == Truncate {
+			if err := s.truncate(tx, order, result); err != nil {
+				return err
+			}
+		}
+		for _, ref := range order {
+			if err := s.loadRow(ctx, tx, fixtures, ref, result); err != nil {
+				return fmt.Errorf("seed: %s: %w", ref, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// truncate deletes the rows of the fixture tables, the referencing
+// tables first.
+func (s *Seeder) truncate(tx *gorm.DB, order []rowRef, result *Result) error {
+	seen := make(map[string]bool)
+	for i := len(order) - 1; i >= 0; i-- {
+		table := order[i].table
+		if seen[table] {
+			continue
+		}
+		seen[table] = true
+
+		m := s.models[table]
+		deleted := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().
+			Delete(reflect.New(m.schema.ModelType).Interface())
+		if deleted.Error != nil {
+			return fmt.Errorf("seed: truncate %s: %w", table, deleted.Error)
+		}
+		result.Deleted += deleted.RowsAffected
+	}
+
+	return nil
+}
+
+func (s *Seeder) loadRow(ctx context.Context, tx *gorm.DB, fixtures Fixtures, ref rowRef, result *Result) error {
+	m := s.models[ref.table]
+	row := reflect.New(m.schema.ModelType)
+	fields := make([]*schema.Field, 0, len(fixtures[ref.table][ref.label]))
+
+	for name, value := range fixtures[ref.table][ref.label] {
+		field, err := m.field(name)
+		if err != nil {
+			return err
+		}
+
+		target, isRef, err := parseRef(value)
+		if err != nil {
+			return err
+		}
+		if isRef {
+			if value, err = primaryKey(ctx, s.models[target.table], result.rows[target]); err != nil {
+				return err
+			}
+		}
+		if err := field.Set(ctx, row.Elem(), unescape(value)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fields = append(fields, field)
+	}
+
+	if s.opts.Strategy == Upsert {
+		updated, err := s.update(ctx, tx, m, row, fields)
+		if err != nil {
+			return err
+		}
+		if updated {
+			result.Updated++
+			result.rows[ref] = row.Interface()
+			return nil
+		}
+	}
+
+	if err := tx.Create(row.Interface()).Error; err != nil {
+		return err
+	}
+	result.Inserted++
+	result.rows[ref] = row.Interface()
+
+	return nil
+}
+
+// update looks up the existing row of a fixture and updates it with the
+// fields of the fixture. It reports whether the row existed.
+func (s *Seeder) update(ctx context.Context, tx *gorm.DB, m *model, row reflect.Value, fields []*schema.Field) (bool, error) {
+	keys := m.keys
+	if len(keys) == 0 {
+		keys = fields
+		if pk := m.schema.PrioritizedPrimaryField; pk != nil {
+			if _, zero := pk.ValueOf(ctx, row.Elem()); !zero {
+				keys = []*schema.Field{pk}
+			}
+		}
+	}
+
+	where := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		where[key.DBName], _ = key.ValueOf(ctx, row.Elem())
+	}
+	existing := reflect.New(m.schema.ModelType)
+	found := tx.Unscoped().Where(where).Limit(1).Find(existing.Interface())
+	if found.Error != nil {
+		return false, found.Error
+	}
+	if found.RowsAffected == 0 {
+		return false, nil
+	}
+
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name
+	}
+	if err := tx.Model(existing.Interface()).Select(names).Updates(row.Interface()).Error; err != nil {
+		return false, err
+	}
+	// Return the existing row with the fixture fields applied.
+	if pk := m.schema.PrioritizedPrimaryField; pk != nil {
+		id, _ := pk.ValueOf(ctx, existing.Elem())
+		where = map[string]interface{}{pk.DBName: id}
+	}
+	if err := tx.Unscoped().Where(where).Take(row.Interface()).Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func primaryKey(ctx context.Context, m *model, row interface{}) (interface{}, error) {
+	pk := m.schema.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, fmt.Errorf("%s has no single primary key to reference", m.schema.Name)
+	}
+	value, _ := pk.ValueOf(ctx, reflect.ValueOf(row).Elem())
+
+	return value, nil
+}
@@ -0,0 +1,217 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type user struct {
+	ID    uint
+	Email string `gorm:"uniqueIndex"`
+	Name  string
+}
+
+type post struct {
+	ID       uint
+	Title    string
+	AuthorID uint
+	Author   *user
+}
+
+// newSeeder returns a Seeder on a SQLite database enforcing foreign
+// keys, with users keyed by email and posts.
+func newSeeder(t *testing.T, strategy Strategy) (*Seeder, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/seed.db?_foreign_keys=1"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&user{}, &post{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(db, Options{Mode: "dev", Strategy: strategy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("users", &user{}, "Email"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("posts", &post{}, "Title"); err != nil {
+		t.Fatal(err)
+	}
+
+	return s, db
+}
+
+func fixtures() Fixtures {
+	return Fixtures{
+		"posts": {
+			"welcome": {"title": "Welcome", "authorId": "@users.alice"},
+			"mention": {"title": "@@alice", "authorId": "@users.bob"},
+		},
+		"users": {
+			"alice": {"email": "alice@example.com", "name": "Alice"},
+			"bob":   {"email": "bob@example.com", "name": "Bob"},
+		},
+	}
+}
+
+func TestCheckMode(t *testing.T) {
+	for _, mode := range []string{"prod", "PROD"} {
+		if err := CheckMode(mode); !errors.Is(err, ErrProduction) {
+			t.Errorf("CheckMode(%q) = %v, want ErrProduction", mode, err)
+		}
+		if _, err := New(nil, Options{Mode: mode}); !errors.Is(err, ErrProduction) {
+			t.Errorf("New in %q = %v, want ErrProduction", mode, err)
+		}
+	}
+	for _, mode := range []string{"dev", "test", ""} {
+		if err := CheckMode(mode); err != nil {
+			t.Errorf("CheckMode(%q) = %v", mode, err)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	order, err := Fixtures{
+		"comments": {"first": {"postId": "@posts.welcome"}},
+		"posts":    {"welcome": {"authorId": "@users.alice"}},
+		"users":    {"alice": {}, "bob": {"name": "@@bob"}},
+	}.order()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rowRef{{"users", "alice"}, {"posts", "welcome"}, {"comments", "first"}, {"users", "bob"}}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestOrderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixtures Fixtures
+		want     string
+	}{
+		{
+			name: "cycle",
+			fixtures: Fixtures{
+				"a": {"x": {"b": "@b.y"}},
+				"b": {"y": {"c": "@c.z"}},
+				"c": {"z": {"a": "@a.x"}},
+			},
+			want: "seed: reference cycle a.x -> b.y -> c.z -> a.x",
+		},
+		{
+			name:     "unknown row",
+			fixtures: Fixtures{"posts": {"welcome": {"authorId": "@users.carol"}}},
+			want:     "seed: posts.welcome.authorId references unknown row users.carol",
+		},
+		{
+			name:     "invalid reference",
+			fixtures: Fixtures{"posts": {"welcome": {"authorId": "@users"}}},
+			want:     `posts.welcome.authorId: seed: invalid reference "@users", want @table.label`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.fixtures.order(); err == nil || err.Error() != tt.want {
+				t.Errorf("order = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadResolvesReferences(t *testing.T) {
+	s, db := newSeeder(t, Upsert)
+
+	result, err := s.Load(context.Background(), fixtures())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 4 || result.Updated != 0 {
+		t.Errorf("inserted %d and updated %d rows, want 4 and 0", result.Inserted, result.Updated)
+	}
+
+	alice := result.Row("users", "alice").(*user)
+	var welcome post
+	if err := db.Preload("Author").Where("title = ?", "Welcome").Take(&welcome).Error; err != nil {
+		t.Fatal(err)
+	}
+	if welcome.AuthorID != alice.ID || welcome.Author.Email != "alice@example.com" {
+		t.Errorf("welcome written by %+v, want alice %d", welcome.Author, alice.ID)
+	}
+	if mention := result.Row("posts", "mention").(*post); mention.Title != "@alice" {
+		t.Errorf("escaped title %q, want @alice", mention.Title)
+	}
+}
+
+func TestLoadUpsertIsIdempotent(t *testing.T) {
+	s, db := newSeeder(t, Upsert)
+	first, err := s.Load(context.Background(), fixtures())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.Load(context.Background(), fixtures())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Inserted != 0 || second.Updated != 4 {
+		t.Errorf("inserted %d and updated %d rows, want 0 and 4", second.Inserted, second.Updated)
+	}
+	for _, ref := range []rowRef{{"users", "alice"}, {"posts", "welcome"}} {
+		if got, want := second.Row(ref.table, ref.label), first.Row(ref.table, ref.label); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s reloaded as %+v, want %+v", ref, got, want)
+		}
+	}
+
+	var users, posts int64
+	db.Model(&user{}).Count(&users)
+	db.Model(&post{}).Count(&posts)
+	if users != 2 || posts != 2 {
+		t.Errorf("%d users and %d posts, want 2 of each", users, posts)
+	}
+}
+
+func TestLoadTruncate(t *testing.T) {
+	s, db := newSeeder(t, Truncate)
+	carol := user{Email: "carol@example.com"}
+	if err := db.Create(&carol).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&post{Title: "Draft", AuthorID: carol.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// With foreign keys enforced, deleting users before posts fails.
+	result, err := s.Load(context.Background(), fixtures())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 2 || result.Inserted != 4 {
+		t.Errorf("deleted %d and inserted %d rows, want 2 and 4", result.Deleted, result.Inserted)
+	}
+	var emails []string
+	db.Model(&user{}).Order("email").Pluck("email", &emails)
+	if want := []string{"alice@example.com", "bob@example.com"}; !reflect.DeepEqual(emails, want) {
+		t.Errorf("users %v, want %v", emails, want)
+	}
+}
+
+func TestLoadUnregisteredTable(t *testing.T) {
+	s, _ := newSeeder(t, Upsert)
+	_, err := s.Load(context.Background(), Fixtures{"comments": {"first": {}}})
+	if err == nil || !strings.Contains(err.Error(), `no model registered for "comments"`) {
+		t.Errorf("Load = %v, want an unregistered table error", err)
+	}
+}
@@ -0,0 +1,28 @@
+// Package seedtest loads fixtures in tests, apart from package seed so
+// that the binaries seeding databases do not link package testing.
+package seedtest
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/seed"
+)
+
+// Load loads the fixture files of fsys matching patterns with s, for
+// integration tests: it fails t on error.
+func Load(t testing.TB, s *seed.Seeder, fsys fs.FS, patterns ...string) *seed.Result {
+	t.Helper()
+
+	fixtures, err := seed.ReadFiles(fsys, patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Load(context.Background(), fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
@@ -0,0 +1,40 @@
+package seedtest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/seed"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type user struct {
+	ID    uint
+	Email string
+}
+
+func TestLoad(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/seed.db"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&user{}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := seed.New(db, seed.Options{Mode: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("users", &user{}, "Email"); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{"users.yml": {Data: []byte("users:\n  alice: {email: alice@example.com}\n")}}
+	result := Load(t, s, fsys, "*.yml")
+	if alice, ok := result.Row("users", "alice").(*user); !ok || alice.ID == 0 {
+		t.Errorf("alice = %+v, want an inserted user", result.Row("users", "alice"))
+	}
+}
@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+)
+
+// pendingPage is the number of pending entries listed at once.
+const pendingPage = 100
+
+// claimLoop claims the stale pending messages of the streams, at start
+// and then every ClaimInterval, until ctx is done.
+func (w *Worker) claimLoop(ctx context.Context, d *dispatcher) {
+	ticker := time.NewTicker(w.cfg.ClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, stream := range w.streams {
+			if err := w.claim(ctx, d, stream); err != nil && ctx.Err() == nil {
+				w.logger.Errorf("worker: claim %s: %v", stream, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim moves the messages of stream pending for MinIdle and delivered
+// MaxDeliveries times to its dead-letter stream, and handles the others
+// again.
+func (w *Worker) claim(ctx context.Context, d *dispatcher, stream string) error {
+	deliveries, err := w.deadLetterPending(ctx, stream)
+	if err != nil {
+		return err
+	}
+
+	start := "0-0"
+	for {
+		n := d.acquire(ctx, w.cfg.Concurrency)
+		if n == 0 {
+			return nil
+		}
+		messages, next, err := w.autoClaim(ctx, stream, start, n)
+		if err != nil {
+			d.release(n)
+			return err
+		}
+
+		for i := range messages {
+			messages[i].Deliveries = deliveries[messages[i].ID] + 1
+		}
+		d.dispatch(ctx, messages, n)
+
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// deadLetterPending moves the messages of stream pending for MinIdle and
+// delivered MaxDeliveries times to its dead-letter stream. It returns
+// the deliveries of the other messages pending for MinIdle by ID.
+func (w *Worker) deadLetterPending(ctx context.Context, stream string) (map[string]int64, error) {
+	deliveries := make(map[string]int64)
+	start := "-"
+	for {
+		pending, err := w.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  w.cfg.Group,
+			Idle:   w.cfg.MinIdle,
+			Start:  start,
+			End:    "+",
+			Count:  pendingPage,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range pending {
+			if p.RetryCount < w.cfg.MaxDeliveries {
+				deliveries[p.ID] = p.RetryCount
+				continue
+			}
+			if err := w.deadLetter(ctx, stream, p.ID, p.RetryCount); err != nil {
+				return nil, err
+			}
+		}
+		if len(pending) < pendingPage {
+			return deliveries, nil
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+}
+
+// deadLetter moves the message id of stream to its dead-letter stream,
+// with the fields of the message and FieldOriginStream, FieldOriginID,
+// FieldGroup and FieldDeliveries.
+func (w *Worker) deadLetter(ctx context.Context, stream, id string, deliveries int64) error {
+	entries, err := w.client.XRangeN(ctx, stream, id, id, 1).Result()
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	if len(entries) > 0 {
+		for key, value := range entries[0].Values {
+			values[key] = value
+		}
+	}
+	values[FieldOriginStream] = stream
+	values[FieldOriginID] = id
+	values[FieldGroup] = w.cfg.Group
+	values[FieldDeliveries] = deliveries
+
+	deadStream := stream + w.cfg.DeadLetterSuffix
+	if err := w.client.XAdd(ctx, &redis.XAddArgs{Stream: deadStream, Values: values}).Err(); err != nil {
+		return err
+	}
+	if err := w.client.XAck(ctx, stream, w.cfg.Group, id).Err(); err != nil {
+		return err
+	}
+
+	w.logger.Warnw("worker: message moved to dead-letter stream", logger.Fields{
+		"stream":     stream,
+		"id":         id,
+		"deadStream": deadStream,
+		"deliveries": deliveries,
+	})
+	return nil
+}
+
+// autoClaim claims up to count messages of stream pending for MinIdle,
+// from the ID start, and returns them with the ID to continue from, "0-0"
+// at the end. It runs XAUTOCLAIM itself as the go-redis command does not
+// parse the reply of Redis 7, which adds the IDs of the deleted entries.
+// Redis 6.2 returns these entries without values instead: they are
+// acknowledged, as there is nothing left to handle.
+func (w *Worker) autoClaim(ctx context.Context, stream, start string, count int) ([]Message, string, error) {
+	reply, err := w.client.Do(ctx, "XAUTOCLAIM", stream, w.cfg.Group, w.consumer,
+		w.cfg.MinIdle.Milliseconds(), start, "COUNT", count).Slice()
+	if err != nil {
+		return nil, "", err
+	}
+	messages, deleted, next, err := parseAutoClaim(stream, reply)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(deleted) > 0 {
+		if err := w.client.XAck(ctx, stream, w.cfg.Group, deleted...).Err(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return messages, next, nil
+}
+
+// parseAutoClaim parses the XAUTOCLAIM reply of stream: the next ID, the
+// claimed entries and, from Redis 7, the IDs of the deleted entries. It
+// returns the messages claimed, the deleted entries still pending, which
+// Redis 6.2 returns without values, and the next ID.
+func parseAutoClaim(stream string, reply []interface{}) (messages []Message, deleted []string, next string, err error) {
+	if len(reply) < 2 {
+		return nil, nil, "", fmt.Errorf("unexpected XAUTOCLAIM reply %v", reply)
+	}
+	next, _ = reply[0].(string)
+	entries, _ := reply[1].([]interface{})
+
+	for _, entry := range entries {
+		parts, ok := entry.([]interface{})
+		if !ok || len(parts) != 2 {
+			continue
+		}
+		id, _ := parts[0].(string)
+		fields, _ := parts[1].([]interface{})
+		if fields == nil {
+			deleted = append(deleted, id)
+			continue
+		}
+
+		values := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			if key, ok := fields[i].(string); ok {
+				values[key] = fields[i+1]
+			}
+		}
+		messages = append(messages, Message{Stream: stream, ID: id, Values: values})
+	}
+
+	return messages, deleted, next, nil
+}
@@ -0,0 +1,330 @@
+// Package worker runs the consumers of Redis Streams alongside the HTTP
+// server of a service, in consumer groups so that the instances of the
+// service share the messages.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/outbox"
+)
+
+// Fields added to the messages moved to a dead-letter stream.
+const (
+	FieldOriginStream = "originStream"
+	FieldOriginID     = "originId"
+	FieldGroup        = "group"
+	FieldDeliveries   = "deliveries"
+)
+
+// retryInterval spaces the reads after a Redis error.
+const retryInterval = time.Second
+
+// Message is an entry of a stream delivered to a Handler.
+type Message struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+	// Deliveries counts the deliveries of the message, this one included.
+	Deliveries int64
+}
+
+// Handler handles the messages of a stream. A message is acknowledged
+// when its handler returns nil; otherwise, or if the handler panics, it
+// is delivered again once pending for MinIdle, so handlers must be
+// idempotent and should return within MinIdle.
+//
+// ctx carries the logger of the Worker, see logger.FromContext, the ID
+// of the message as request id and its trace id: the traceId field or
+// outbox header of the message, or a new one.
+type Handler func(ctx context.Context, msg Message) error
+
+// Worker consumes Redis Streams with handlers, as a consumer of a group.
+type Worker struct {
+	client   redis.UniversalClient
+	cfg      config.WorkerConfig
+	logger   logger.Logger
+	consumer string
+
+	streams  []string
+	handlers map[string]Handler
+}
+
+func New(client redis.UniversalClient, cfg config.WorkerConfig, logger logger.Logger) *Worker {
+	cfg = cfg.WithDefaults()
+	consumer := cfg.Consumer
+	if consumer == "" {
+		host, _ := os.Hostname()
+		consumer = host + "-" + strconv.Itoa(os.Getpid())
+	}
+
+	return &Worker{
+		client:   client,
+		cfg:      cfg,
+		logger:   logger,
+		consumer: consumer,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle consumes stream with handler. It must be called before Run.
+func (w *Worker) Handle(stream string, handler Handler) {
+	if _, ok := w.handlers[stream]; !ok {
+		w.streams = append(w.streams, stream)
+	}
+	w.handlers[stream] = handler
+}
+
+// Streams returns the streams with a handler, in the order they were
+// added.
+func (w *Worker) Streams() []string {
+	return append([]string(nil), w.streams...)
+}
+
+// Run consumes the streams until ctx is done, then waits for the
+// messages being handled, cancelling their context after DrainTimeout.
+// The group of the Worker is created on the streams if needed, reading
+// them from the start.
+func (w *Worker) Run(ctx context.Context) error {
+	if len(w.streams) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+	for _, stream := range w.streams {
+		err := w.client.XGroupCreateMkStream(ctx, stream, w.cfg.Group, "0").Err()
+		if err != nil && !isBusyGroup(err) {
+			return fmt.Errorf("worker: create group %s on %s: %w", w.cfg.Group, stream, err)
+		}
+	}
+
+	handlersCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+	d := &dispatcher{
+		worker: w,
+		ctx:    handlersCtx,
+		slots:  make(chan struct{}, w.cfg.Concurrency),
+	}
+
+	// Each stream is read on its own: in a Redis Cluster the streams of a
+	// single XREADGROUP must share a hash slot.
+	var loops sync.WaitGroup
+	loops.Add(len(w.streams) + 1)
+	for _, stream := range w.streams {
+		stream := stream
+		go func() {
+			defer loops.Done()
+			w.read(ctx, d, stream)
+		}()
+	}
+	go func() {
+		defer loops.Done()
+		w.claimLoop(ctx, d)
+	}()
+	loops.Wait()
+
+	drained := make(chan struct{})
+	go func() {
+		d.handling.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(w.cfg.DrainTimeout):
+		w.logger.Warnf("worker: messages still handled after %s, cancelling them", w.cfg.DrainTimeout)
+		cancelHandlers()
+		<-drained
+	}
+
+	return nil
+}
+
+// isBusyGroup reports whether err tells that the group already exists.
+func isBusyGroup(err error) bool {
+	return strings.HasPrefix(err.Error(), "BUSYGROUP")
+}
+
+// dispatcher runs the handlers of the messages, at most Concurrency at
+// once.
+type dispatcher struct {
+	worker *Worker
+	// ctx is the parent context of the handlers, cancelled when the
+	// drain times out.
+	ctx      context.Context
+	slots    chan struct{}
+	handling sync.WaitGroup
+}
+
+// acquire waits for a free handler slot and takes up to max of them,
+// returning how many, or 0 once ctx is done.
+func (d *dispatcher) acquire(ctx context.Context, max int) int {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+
+	n := 1
+	for n < max {
+		select {
+		case d.slots <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+
+	return n
+}
+
+func (d *dispatcher) release(n int) {
+	for i := 0; i < n; i++ {
+		<-d.slots
+	}
+}
+
+// free waits for a free handler slot and returns how many are free,
+// or 0 once ctx is done. The slots are not taken.
+func (d *dispatcher) free(ctx context.Context) int {
+	n := d.acquire(ctx, cap(d.slots))
+	d.release(n)
+
+	return n
+}
+
+// dispatch handles the messages with the n slots taken for them,
+// waiting for more slots if needed. The messages left when ctx is done
+// stay pending, to be claimed again.
+func (d *dispatcher) dispatch(ctx context.Context, messages []Message, n int) {
+	for i, msg := range messages {
+		if i >= n && d.acquire(ctx, 1) == 0 {
+			return
+		}
+
+		msg := msg
+		d.handling.Add(1)
+		go func() {
+			defer d.handling.Done()
+			defer d.release(1)
+			d.worker.handle(d.ctx, msg)
+		}()
+	}
+	if len(messages) < n {
+		d.release(n - len(messages))
+	}
+}
+
+// read delivers the new messages of stream until ctx is done. No slot
+// is held while waiting for messages, so that the streams without any do
+// not keep the others from being handled.
+func (w *Worker) read(ctx context.Context, d *dispatcher, stream string) {
+	for {
+		n := d.free(ctx)
+		if n == 0 {
+			return
+		}
+
+		results, err := w.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    w.cfg.Group,
+			Consumer: w.consumer,
+			Streams:  []string{stream, ">"},
+			Count:    int64(n),
+			Block:    w.cfg.Block,
+		}).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, redis.Nil) {
+				w.logger.Errorf("worker: read %s: %v", stream, err)
+				sleep(ctx, retryInterval)
+			}
+			continue
+		}
+
+		var messages []Message
+		for _, result := range results {
+			for _, entry := range result.Messages {
+				messages = append(messages, Message{Stream: result.Stream, ID: entry.ID, Values: entry.Values, Deliveries: 1})
+			}
+		}
+		// The slots freed meanwhile may have been taken by the other
+		// streams: wait for them message by message.
+		d.dispatch(ctx, messages, 0)
+	}
+}
+
+// handle runs the handler of msg and acknowledges it on success.
+func (w *Worker) handle(ctx context.Context, msg Message) {
+	ctx = w.messageContext(ctx, msg)
+	if err := w.call(ctx, msg); err != nil {
+		fields := logger.ContextFields(ctx)
+		fields["stream"] = msg.Stream
+		fields["deliveries"] = msg.Deliveries
+		fields["error"] = err.Error()
+		w.logger.Errorw("worker: handler failed", fields)
+		return
+	}
+
+	if err := w.client.XAck(ctx, msg.Stream, w.cfg.Group, msg.ID).Err(); err != nil {
+		w.logger.Errorf("worker: ack %s %s: %v", msg.Stream, msg.ID, err)
+	}
+}
+
+// call runs the handler of msg, turning a panic into an error.
+func (w *Worker) call(ctx context.Context, msg Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return w.handlers[msg.Stream](ctx, msg)
+}
+
+func (w *Worker) messageContext(ctx context.Context, msg Message) context.Context {
+	traceID := messageTraceID(msg)
+	if traceID == "" {
+		traceID = logger.NewID()
+	}
+
+	ctx = logger.WithLogger(ctx, w.logger)
+	ctx = logger.WithRequestID(ctx, msg.ID)
+	return logger.WithTraceID(ctx, traceID)
+}
+
+// messageTraceID returns the trace id of msg, from its traceId field or
+// the traceId header of an outbox message, or "".
+func messageTraceID(msg Message) string {
+	if id, ok := msg.Values[outbox.HeaderTraceID].(string); ok && id != "" {
+		return id
+	}
+	if data, ok := msg.Values[outbox.FieldHeaders].(string); ok {
+		var headers map[string]string
+		if json.Unmarshal([]byte(data), &headers) == nil {
+			return headers[outbox.HeaderTraceID]
+		}
+	}
+
+	return ""
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
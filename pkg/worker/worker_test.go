@@ -0,0 +1,305 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+)
+
+func newTestWorker(t *testing.T, cfg config.WorkerConfig) (*Worker, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	cfg.Group = "test"
+	cfg.Consumer = "worker"
+	if cfg.Block == 0 {
+		cfg.Block = 20 * time.Millisecond
+	}
+	logger := zap.NewZapLogger(&config.LoggerConfig{LogLevel: "fatal"}, &config.ServerConfig{})
+
+	return New(client, cfg, logger), client
+}
+
+// run runs w until the returned func is called, which waits for Run.
+func run(t *testing.T, w *Worker) (stop func() time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	return func() time.Duration {
+		start := time.Now()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run = %v", err)
+		}
+		return time.Since(start)
+	}
+}
+
+func add(t *testing.T, client *redis.Client, stream string, values map[string]interface{}) string {
+	t.Helper()
+	id, err := client.XAdd(context.Background(), &redis.XAddArgs{Stream: stream, Values: values}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// eventually waits for cond, failing the test after a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func pending(t *testing.T, client *redis.Client, stream string) int64 {
+	t.Helper()
+	p, err := client.XPending(context.Background(), stream, "test").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p.Count
+}
+
+func TestWorkerAcksHandledMessages(t *testing.T) {
+	w, client := newTestWorker(t, config.WorkerConfig{})
+	var handled int32
+	w.Handle("events", func(ctx context.Context, msg Message) error {
+		defer atomic.AddInt32(&handled, 1)
+		if msg.Values["result"] == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	stop := run(t, w)
+	defer stop()
+
+	eventually(t, "the group", func() bool { return client.Exists(context.Background(), "events").Val() == 1 })
+	add(t, client, "events", map[string]interface{}{"result": "ok"})
+	failed := add(t, client, "events", map[string]interface{}{"result": "fail"})
+	add(t, client, "events", map[string]interface{}{"result": "ok"})
+
+	eventually(t, "the messages", func() bool { return atomic.LoadInt32(&handled) == 3 })
+	eventually(t, "the acks", func() bool { return pending(t, client, "events") == 1 })
+	p, err := client.XPendingExt(context.Background(), &redis.XPendingExtArgs{
+		Stream: "events", Group: "test", Start: "-", End: "+", Count: 10,
+	}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 || p[0].ID != failed {
+		t.Errorf("pending %v, want only the failed message %s", p, failed)
+	}
+}
+
+func TestWorkerConcurrency(t *testing.T) {
+	const concurrency = 2
+	w, client := newTestWorker(t, config.WorkerConfig{Concurrency: concurrency})
+	var handled, inFlight, maxInFlight int32
+	handler := func(ctx context.Context, msg Message) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}
+	w.Handle("a", handler)
+	w.Handle("b", handler)
+	w.Handle("idle", handler)
+	stop := run(t, w)
+	defer stop()
+
+	eventually(t, "the groups", func() bool { return client.Exists(context.Background(), "a", "b").Val() == 2 })
+	for i := 0; i < 10; i++ {
+		add(t, client, "a", map[string]interface{}{"i": i})
+		add(t, client, "b", map[string]interface{}{"i": i})
+	}
+
+	eventually(t, "the messages", func() bool { return atomic.LoadInt32(&handled) == 20 })
+	if max := atomic.LoadInt32(&maxInFlight); max > concurrency {
+		t.Errorf("%d messages handled at once, want at most %d", max, concurrency)
+	}
+}
+
+func TestWorkerDrainTimeout(t *testing.T) {
+	w, client := newTestWorker(t, config.WorkerConfig{DrainTimeout: 50 * time.Millisecond})
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	w.Handle("events", func(ctx context.Context, msg Message) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	stop := run(t, w)
+
+	eventually(t, "the group", func() bool { return client.Exists(context.Background(), "events").Val() == 1 })
+	add(t, client, "events", map[string]interface{}{"slow": true})
+	<-started
+
+	if took := stop(); took < 50*time.Millisecond || took > time.Second {
+		t.Errorf("Run returned %s after the stop, want about the drain timeout", took)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("the context of the handler was not cancelled")
+	}
+	if n := pending(t, client, "events"); n != 1 {
+		t.Errorf("%d messages pending, want the cancelled one", n)
+	}
+}
+
+func TestDeadLetterPending(t *testing.T) {
+	w, client := newTestWorker(t, config.WorkerConfig{MinIdle: time.Millisecond, MaxDeliveries: 3})
+	ctx := context.Background()
+	if err := client.XGroupCreateMkStream(ctx, "events", "test", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	exhausted := add(t, client, "events", map[string]interface{}{"n": "1"})
+	retried := add(t, client, "events", map[string]interface{}{"n": "2"})
+	if err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: "test", Consumer: "worker", Streams: []string{"events", ">"},
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	// Each claim is a delivery: exhausted reaches MaxDeliveries.
+	for i := 0; i < 2; i++ {
+		if err := client.XClaim(ctx, &redis.XClaimArgs{
+			Stream: "events", Group: "test", Consumer: "worker", Messages: []string{exhausted},
+		}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	deliveries, err := w.deadLetterPending(ctx, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{retried: 1}; !reflect.DeepEqual(deliveries, want) {
+		t.Errorf("deliveries = %v, want %v", deliveries, want)
+	}
+
+	dead, err := client.XRange(ctx, "events:dead", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("dead-letter stream holds %d messages, want 1", len(dead))
+	}
+	want := map[string]interface{}{
+		"n":               "1",
+		FieldOriginStream: "events",
+		FieldOriginID:     exhausted,
+		FieldGroup:        "test",
+		FieldDeliveries:   "3",
+	}
+	if !reflect.DeepEqual(dead[0].Values, want) {
+		t.Errorf("dead letter = %v, want %v", dead[0].Values, want)
+	}
+	if n := pending(t, client, "events"); n != 1 {
+		t.Errorf("%d messages pending, want the retried one", n)
+	}
+}
+
+func TestParseAutoClaim(t *testing.T) {
+	fields := []interface{}{"k", "v"}
+	message := Message{Stream: "events", ID: "1-0", Values: map[string]interface{}{"k": "v"}}
+
+	tests := []struct {
+		name     string
+		reply    []interface{}
+		messages []Message
+		deleted  []string
+		next     string
+	}{
+		{
+			name:     "redis 7 with deleted IDs",
+			reply:    []interface{}{"0-0", []interface{}{[]interface{}{"1-0", fields}}, []interface{}{"2-0"}},
+			messages: []Message{message},
+			next:     "0-0",
+		},
+		{
+			name:     "redis 6.2 with deleted entry",
+			reply:    []interface{}{"3-0", []interface{}{[]interface{}{"1-0", fields}, []interface{}{"2-0", nil}}},
+			messages: []Message{message},
+			deleted:  []string{"2-0"},
+			next:     "3-0",
+		},
+		{
+			name:  "nothing claimed",
+			reply: []interface{}{"0-0", []interface{}{}, []interface{}{}},
+			next:  "0-0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, deleted, next, err := parseAutoClaim("events", tt.reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(messages, tt.messages) || !reflect.DeepEqual(deleted, tt.deleted) || next != tt.next {
+				t.Errorf("parseAutoClaim = %v, %v, %s, want %v, %v, %s", messages, deleted, next, tt.messages, tt.deleted, tt.next)
+			}
+		})
+	}
+
+	if _, _, _, err := parseAutoClaim("events", []interface{}{"0-0"}); err == nil {
+		t.Error("short reply accepted")
+	}
+}
+
+func TestClaimRedelivers(t *testing.T) {
+	w, client := newTestWorker(t, config.WorkerConfig{MinIdle: time.Millisecond, ClaimInterval: 10 * time.Millisecond})
+	var attempts int32
+	delivered := make(chan int64, 10)
+	w.Handle("events", func(ctx context.Context, msg Message) error {
+		delivered <- msg.Deliveries
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return fmt.Errorf("first attempt")
+		}
+		return nil
+	})
+	stop := run(t, w)
+	defer stop()
+
+	eventually(t, "the group", func() bool { return client.Exists(context.Background(), "events").Val() == 1 })
+	add(t, client, "events", map[string]interface{}{"n": "1"})
+
+	for _, want := range []int64{1, 2} {
+		select {
+		case got := <-delivered:
+			if got != want {
+				t.Errorf("delivery %d, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no delivery %d", want)
+		}
+	}
+	eventually(t, "the ack", func() bool { return pending(t, client, "events") == 0 })
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/app"
+)
+
+const configUsage = `usage: app config <command>
+
+commands:
+  explain      print the effective value, source and overrides of every key
+  keygen       print a new encryption key
+  encrypt      encrypt a value (argument or stdin) for use in config files
+  decrypt      decrypt an ENC[AES256_GCM,...] value
+  rotate-key   re-encrypt the values of config files with a new key
+  schema       print the JSON Schema of the config files
+
+encrypt, decrypt and rotate-key read the current key from ` + app.EnvPrefix + `_CONFIG_KEY
+or the file named by ` + app.EnvPrefix + `_CONFIG_KEYFILE, unless -key-file is given.`
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "explain":
+		return explainConfig()
+	case "keygen":
+		return generateKey()
+	case "encrypt", "decrypt":
+		return cryptValue(args[0], args[1:])
+	case "rotate-key":
+		return rotateKey(args[1:])
+	case "schema":
+		return printSchema(args[1:])
+	}
+
+	return fmt.Errorf("unknown config command %q\n%s", args[0], configUsage)
+}
+
+// explainConfig prints the merged config with the layer each value comes
+// from: defaults, config files or environment variables.
+func explainConfig() error {
+	origins, err := newConfigLoader().Explain()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tOVERRIDES")
+	for _, o := range origins {
+		overrides := make([]string, len(o.Overridden))
+		for i, lv := range o.Overridden {
+			overrides[i] = fmt.Sprintf("%s=%v", lv.Source, formatValue(lv.Value))
+		}
+		source := o.Source
+		if source == "" {
+			source = "unset"
+		}
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\n", o.Key, formatValue(o.Value), source, strings.Join(overrides, ", "))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := newConfigLoader().Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nconfig is not valid: %v\n", err)
+	}
+
+	return nil
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+
+	return fmt.Sprint(v)
+}
+
+func generateKey() error {
+	key, err := config.GenerateKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(config.EncodeKey(key))
+
+	return nil
+}
+
+// cryptValue encrypts or decrypts the value given as argument or on stdin.
+func cryptValue(command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "file holding the encryption key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	value := fs.Arg(0)
+	if fs.NArg() == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if command == "encrypt" {
+		value, err = config.Encrypt(key, value)
+	} else {
+		value, err = config.Decrypt(key, value)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+
+	return nil
+}
+
+// rotateKey re-encrypts the given files, the -config files or every file
+// of the config folder with the key read from -new-key-file.
+func rotateKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "file holding the current encryption key")
+	newKeyFile := fs.String("new-key-file", "", "file holding the new encryption key (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *newKeyFile == "" {
+		return errors.New("rotate-key: -new-key-file is required")
+	}
+
+	oldKey, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	newKey, err := config.ReadKeyFile(*newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = configFiles
+	}
+	if len(files) == 0 {
+		if files, err = listConfigFiles(configsDir); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		n, err := config.RotateKey(file, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d values rotated\n", file, n)
+	}
+
+	return nil
+}
+
+func readKey(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		return config.ReadKeyFile(keyFile)
+	}
+
+	return config.KeyFromEnv(app.EnvPrefix)
+}
+
+// listConfigFiles lists the config files in dir.
+func listConfigFiles(dir string) ([]string, error) {
+	var files []string
+	for _, ext := range config.ConfigExts {
+		matches, err := filepath.Glob(filepath.Join(dir, "*."+ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// printSchema prints the JSON Schema of base.yml, or with -partial of the
+// overlays, which only set some keys.
+func printSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	partial := fs.Bool("partial", false, "omit required keys, for overlay files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	schema := config.Schema(config.Config{}, config.SchemaOptions{
+		Title:    "app1 config",
+		Partial:  *partial,
+		Defaults: config.DefaultValues(),
+	})
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(schema)
+}
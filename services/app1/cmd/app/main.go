@@ -1,11 +1,69 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/app"
 )
 
 const configsDir = "config"
 
+// configFiles are set with -config. They replace the overlays of configsDir.
+var configFiles fileList
+
 func main() {
-	app.Run(configsDir)
+	flag.Var(&configFiles, "config", "config file to load instead of the "+configsDir+" folder overlays; repeat to merge several")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	app.Run(configDir(), configFiles)
+}
+
+func runCommand(name string, args []string) error {
+	switch name {
+	case "config":
+		return runConfig(args)
+	case "migrate":
+		return runMigrate(args)
+	case "seed":
+		return runSeed(args)
+	}
+
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// configDir returns the folder the overlays are read from, if any.
+func configDir() string {
+	if len(configFiles) > 0 {
+		return ""
+	}
+
+	return configsDir
+}
+
+func newConfigLoader() *config.Loader {
+	return app.NewConfigLoader(configDir(), configFiles)
+}
+
+// fileList is a repeatable flag.
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
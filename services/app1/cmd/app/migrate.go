@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/migrate"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/migrations"
+)
+
+const migrateUsage = `usage: app migrate [-dry-run] [-lock-timeout 1m] <command>
+
+commands:
+  up           apply every pending migration
+  down [n]     revert the n last applied migrations, 1 by default
+  to <version> apply or revert migrations up to version
+  status       list the migrations and whether they are applied
+  force <version> applied|reverted
+               clear the dirty mark a failed MySQL migration left on version,
+               once completed or undone by hand, recording it as such
+
+-dry-run prints the migrations a command would run without running them.`
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the migrations to run without running them")
+	lockTimeout := fs.Duration("lock-timeout", time.Minute, "wait for a migration run by another process up to this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	cfg, err := newConfigLoader().Load()
+	if err != nil {
+		return err
+	}
+	logger := zap.NewZapLogger(&cfg.Logger, &cfg.Server)
+
+	ctx := context.Background()
+	connectCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	database, err := db.Connect(connectCtx, &cfg.Database, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close(database)
+	}()
+	sqlDB, err := database.DB()
+	if err != nil {
+		return err
+	}
+
+	migrator, err := migrate.New(sqlDB, cfg.Database.Driver, migrate.Options{
+		LockTimeout: *lockTimeout,
+		DryRun:      *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if err := migrator.AddFS(migrations.FS, ".", cfg.Database.Driver); err != nil {
+		return err
+	}
+
+	var steps []migrate.Step
+	switch command := fs.Arg(0); command {
+	case "up":
+		steps, err = migrator.Up(ctx)
+	case "down":
+		n := 1
+		if fs.NArg() > 1 {
+			if n, err = strconv.Atoi(fs.Arg(1)); err != nil || n < 1 {
+				return fmt.Errorf("migrate down: invalid count %q", fs.Arg(1))
+			}
+		}
+		steps, err = migrator.Down(ctx, n)
+	case "to":
+		if fs.NArg() < 2 {
+			return errors.New("migrate to: version is required")
+		}
+		version, parseErr := strconv.ParseInt(fs.Arg(1), 10, 64)
+		if parseErr != nil {
+			return fmt.Errorf("migrate to: invalid version %q", fs.Arg(1))
+		}
+		steps, err = migrator.To(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	case "force":
+		if fs.NArg() < 3 || (fs.Arg(2) != "applied" && fs.Arg(2) != "reverted") {
+			return errors.New("migrate force: usage: force <version> applied|reverted")
+		}
+		version, parseErr := strconv.ParseInt(fs.Arg(1), 10, 64)
+		if parseErr != nil {
+			return fmt.Errorf("migrate force: invalid version %q", fs.Arg(1))
+		}
+		return migrator.Force(ctx, version, fs.Arg(2) == "applied")
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+
+	printSteps(steps, *dryRun)
+
+	return err
+}
+
+// printSteps prints the steps run, or with dryRun the steps to run and
+// their SQL.
+func printSteps(steps []migrate.Step, dryRun bool) {
+	if len(steps) == 0 {
+		fmt.Println("no migration to run")
+		return
+	}
+
+	for _, step := range steps {
+		if !dryRun {
+			fmt.Printf("%s %s\n", step.Direction, step.Migration)
+			continue
+		}
+		fmt.Printf("-- %s %s (dry run)\n", step.Direction, step.Migration)
+		if sql := step.SQL(); sql != "" {
+			fmt.Println(sql)
+		} else {
+			fmt.Println("-- Go migration")
+		}
+	}
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		name, status, appliedAt := s.Name, "pending", "-"
+		if name == "" {
+			name = "-"
+		}
+		if s.Applied {
+			status, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Unknown {
+			status = "applied, unknown to this binary"
+		}
+		if s.Dirty {
+			status = "dirty, see migrate force"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, name, status, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/seed"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/fixtures"
+)
+
+// runSeed loads the given fixture files, or the embedded dev dataset,
+// into the database. It refuses to run in the prod mode or environment.
+func runSeed(args []string) error {
+	fset := flag.NewFlagSet("seed", flag.ContinueOnError)
+	truncate := fset.Bool("truncate", false, "empty the fixture tables before loading")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "usage: app seed [-truncate] [fixture files or globs...]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	loader := newConfigLoader()
+	if err := seed.CheckMode(loader.Environment()); err != nil {
+		return err
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	logger := zap.NewZapLogger(&cfg.Logger, &cfg.Server)
+
+	if err := seed.CheckMode(cfg.Server.Mode); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	connectCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	database, err := db.Connect(connectCtx, &cfg.Database, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close(database)
+	}()
+
+	strategy := seed.Upsert
+	if *truncate {
+		strategy = seed.Truncate
+	}
+	seeder, err := seed.New(database, seed.Options{Mode: cfg.Server.Mode, Strategy: strategy})
+	if err != nil {
+		return err
+	}
+	if err := fixtures.Register(seeder); err != nil {
+		return err
+	}
+
+	var fsys fs.FS = fixtures.FS
+	patterns := []string{"*.yml"}
+	if fset.NArg() > 0 {
+		fsys, patterns = os.DirFS("."), fset.Args()
+	}
+	data, err := seed.ReadFiles(fsys, patterns...)
+	if err != nil {
+		return err
+	}
+
+	result, err := seeder.Load(ctx, data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d rows inserted, %d updated, %d deleted\n", result.Inserted, result.Updated, result.Deleted)
+
+	return nil
+}
@@ -0,0 +1,18 @@
+// Package fixtures embeds the dev dataset of app1, loaded with `app seed`,
+// and registers the models fixtures can fill. See pkg/seed.
+package fixtures
+
+import (
+	"embed"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/seed"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/model"
+)
+
+//go:embed *.yml
+var FS embed.FS
+
+// Register maps the fixture tables to the models of app1.
+func Register(s *seed.Seeder) error {
+	return s.Register("users", &model.User{}, "Email")
+}
@@ -3,67 +3,198 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/featureflag"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/lock"
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger/zap"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/outbox"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/ratelimit"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/worker"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/consumer"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/handler"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/repository"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/server"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/service"
 )
 
+const (
+	// EnvPrefix namespaces the environment variables overriding this service's config.
+	EnvPrefix = "APP1"
+
+	// connectTimeout bounds the retries of the startup connections.
+	connectTimeout = time.Minute
+)
+
+// NewConfigLoader returns the loader reading this service's config from the
+// overlays in configPath, selected by APP_ENV and APP_REGION, then configFiles.
+func NewConfigLoader(configPath string, configFiles []string) *config.Loader {
+	return config.NewLoader(config.LoaderOptions{
+		ConfigDir:   configPath,
+		Environment: os.Getenv("APP_ENV"),
+		Region:      os.Getenv("APP_REGION"),
+		EnvPrefix:   EnvPrefix,
+		Files:       configFiles,
+	})
+}
+
 // Run initializes whole application.
-func Run(configPath string) {
+func Run(configPath string, configFiles []string) {
 	log.Println("Starting api server")
-	cfg, err := config.Init(configPath)
+	loader := NewConfigLoader(configPath, configFiles)
+	watcher, err := config.NewWatcher(loader)
 
 	if err != nil {
 		log.Fatalf("ParseConfig: %v", err)
 	}
+	cfg := watcher.Config()
 
 	logger := zap.NewZapLogger(&cfg.Logger, &cfg.Server)
 	logger.Infof("AppVersion: %s, LogLevel: %s, Mode: %s", cfg.Server.AppVersion, cfg.Logger.LogLevel, cfg.Server.Mode)
+	for _, warning := range loader.Warnings() {
+		logger.Warnf("Config: %s", warning)
+	}
+
+	// Config hot-reload
+	watcher.OnError(func(err error) {
+		logger.Errorf("config reload rejected, keeping last good config: %v", err)
+	})
+	watcher.Subscribe(config.SectionLogger, func(cfg *config.Config) {
+		logger.SetLevel(cfg.Logger.LogLevel)
+		logger.Infof("LogLevel changed: %s", cfg.Logger.LogLevel)
+	})
+	watcher.Subscribe(config.SectionHTTP, func(cfg *config.Config) {
+		logger.Warn("HTTP config changed, restart required to apply it")
+	})
+	watcher.Subscribe(config.SectionRateLimit, func(cfg *config.Config) {
+		logger.Warn("Rate limit config changed, restart required to apply it")
+	})
+	if err := watcher.Start(); err != nil {
+		logger.Errorf("config watch: %v, changes need a restart", err)
+	}
+	defer watcher.Close()
+
+	connectCtx, cancelConnect := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancelConnect()
 
-	mysqlDB := db.ConnectMySQL(&cfg.Mysql, logger)
+	database, err := db.Connect(connectCtx, &cfg.Database, logger)
 	if err != nil {
-		logger.Fatalf("Postgresql init: %s", err)
+		logger.Fatalf("Database init: %s", err)
 	} else {
-		logger.Infof("Mysql connected")
+		logger.Infof("Database connected: %s", cfg.Database.Driver)
 	}
 
 	defer func() {
-		dbInstance, _ := mysqlDB.DB()
-		_ = dbInstance.Close()
-		logger.Info("Mysql closed")
+		_ = db.Close(database)
+		logger.Info("Database closed")
 	}()
 
-	redisClient := db.ConnectRedis(&cfg.Redis)
+	redisClient, err := db.ConnectRedis(connectCtx, &cfg.Redis, logger)
+	if err != nil {
+		logger.Fatalf("Redis init: %s", err)
+	} else {
+		logger.Infof("Redis connected")
+	}
+
 	defer func() {
 		_ = redisClient.Close()
 		logger.Info("Redis closed")
 	}()
-	logger.Info("Redis connected")
+
+	poolStats := db.NewStatsCollector()
+	if sqlDB, err := database.DB(); err == nil {
+		poolStats.AddSQL(cfg.Database.Driver, sqlDB)
+	}
+	for i, replica := range db.ReplicaPools(database) {
+		poolStats.AddSQL(fmt.Sprintf("%s-replica-%d", cfg.Database.Driver, i), replica)
+	}
+	poolStats.AddRedis("redis", redisClient)
+
+	// Feature flags
+	featureFlags := featureflag.New(cfg.FeatureFlags, redisClient, logger, featureflag.Options{})
+	if err := featureFlags.Start(context.Background()); err != nil {
+		logger.Fatalf("Feature flags init: %s", err)
+	}
+	defer func() {
+		_ = featureFlags.Close()
+	}()
+	watcher.Subscribe(config.SectionFeatureFlags, func(cfg *config.Config) {
+		featureFlags.SetDefaults(cfg.FeatureFlags)
+		logger.Info("Feature flags changed")
+	})
+
+	// Background workers stop after the HTTP server, finishing the messages
+	// being handled, and before the connections they use are closed.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+		logger.Info("Workers stopped")
+	}()
 
 	// Services, Repos & API Handlers
-	repos := repository.NewRepositories(mysqlDB)
+	repos := repository.NewRepositories(database)
+
+	if cfg.Outbox.Enabled {
+		broker := outbox.NewRedisBroker(redisClient, cfg.Outbox.StreamPrefix, cfg.Outbox.StreamMaxLen)
+		relay := outbox.NewRelay(database, broker, logger, cfg.Outbox)
+		repos.Outbox.OnCommit(relay.Wake)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			relay.Run(workersCtx)
+		}()
+		logger.Info("Outbox relay started")
+	}
+
+	cacheTTL := service.NewCacheTTL(cfg.CacheTTL)
+	watcher.Subscribe(config.SectionCacheTTL, func(cfg *config.Config) {
+		cacheTTL.Set(cfg.CacheTTL)
+		logger.Infof("Cache TTL changed: %s", cfg.CacheTTL)
+	})
 
 	services := service.NewServices(service.Deps{
-		Repos: repos,
+		Repos:  repos,
+		Tx:     db.NewTxManager(database, db.TxOptions{Logger: logger}),
+		Locker: lock.NewRedisLocker(redisClient, "", lock.Options{Logger: logger}),
 		//Cache:                  memCache,
-		CacheTTL:    int64(cfg.CacheTTL.Seconds()),
+		CacheTTL:    cacheTTL,
 		Environment: cfg.Server.Mode,
 		Domain:      cfg.HTTP.Host,
 		Logger:      logger,
 	})
 
-	handlers := handler.NewHandler(services, logger)
+	if cfg.Worker.Enabled {
+		streamWorker := worker.New(redisClient, cfg.Worker, logger)
+		consumer.Register(streamWorker, services, cfg)
+
+		if streams := streamWorker.Streams(); len(streams) == 0 {
+			logger.Warn("Stream workers enabled without any stream handler, not started")
+		} else {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				if err := streamWorker.Run(workersCtx); err != nil {
+					logger.Errorf("Stream workers: %s", err)
+				}
+			}()
+			logger.Infof("Stream workers started on %v", streams)
+		}
+	}
+
+	rateLimiter := ratelimit.WithFallback(ratelimit.NewRedisLimiter(redisClient, cfg.RateLimit.Prefix), ratelimit.NewMemoryLimiter(), logger)
+	handlers := handler.NewHandler(services, featureFlags, poolStats, rateLimiter, logger)
 
 	// HTTP Server
 	srv := server.NewServer(cfg, handlers.Init(cfg))
@@ -0,0 +1,15 @@
+// Package consumer holds the handlers of the Redis Streams consumed by
+// the service.
+package consumer
+
+import (
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/worker"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/service"
+)
+
+// Register adds the stream handlers of the service to w. The service
+// consumes no stream yet, so the worker is not started even when
+// worker.enabled is set; the streams published by the outbox are named
+// cfg.Outbox.StreamPrefix + topic.
+func Register(w *worker.Worker, services *service.Services, cfg *config.Config) {}
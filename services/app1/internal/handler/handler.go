@@ -1,40 +1,96 @@
 package handler
 
 import (
+	"net"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/config"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/featureflag"
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/ratelimit"
 	v1 "github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/handler/v1"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/service"
 )
 
 type Handler struct {
-	services *service.Services
-	logger   logger.Logger
+	services     *service.Services
+	featureFlags *featureflag.Client
+	poolStats    *db.StatsCollector
+	rateLimiter  ratelimit.Limiter
+	logger       logger.Logger
 }
 
-func NewHandler(services *service.Services, logger logger.Logger) *Handler {
+func NewHandler(services *service.Services, featureFlags *featureflag.Client, poolStats *db.StatsCollector, rateLimiter ratelimit.Limiter, logger logger.Logger) *Handler {
 	return &Handler{
-		services: services,
-		logger:   logger,
+		services:     services,
+		featureFlags: featureFlags,
+		poolStats:    poolStats,
+		rateLimiter:  rateLimiter,
+		logger:       logger,
 	}
 }
 
 func (h *Handler) Init(cfg *config.Config) *echo.Echo {
 	e := echo.New()
+	e.IPExtractor = ipExtractor(cfg.HTTP.TrustedProxies)
+
+	e.Use(logger.ContextMiddleware)
+	if cfg.RateLimit.Enabled {
+		// The API has no authentication yet: every request is counted by IP.
+		e.Use(ratelimit.Middleware(h.rateLimiter, cfg.RateLimit, nil, h.logger))
+	}
+	e.Use(readYourWrites)
+	e.Use(featureflag.Middleware(h.featureFlags, anonymous))
 
 	// Init router
 	e.GET("/ping", func(c echo.Context) error {
 		return c.String(http.StatusOK, "Hello, World!")
 	})
+	e.GET("/health/pools", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, h.poolStats.Collect())
+	})
 
 	h.initAPI(e)
 
 	return e
 }
 
+// anonymous is the flag subject of every request while the API has no
+// authentication: only the flags at percentage 100 are on.
+func anonymous(echo.Context) (user, tenant string) {
+	return "", ""
+}
+
+// ipExtractor returns how the client IP is read: from X-Forwarded-For
+// when the request comes through one of the trusted proxies, and from the
+// connection otherwise.
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// Echo trusts private networks by default: only trust the proxies.
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		// The CIDRs are checked when the config is validated.
+		if _, ipNet, err := net.ParseCIDR(proxy); err == nil {
+			options = append(options, echo.TrustIPRange(ipNet))
+		}
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// readYourWrites lets the reads of a request see its own writes, see db.WithReadYourWrites.
+func readYourWrites(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.SetRequest(c.Request().WithContext(db.WithReadYourWrites(c.Request().Context())))
+		return next(c)
+	}
+}
+
 func (h *Handler) initAPI(e *echo.Echo) {
 	handlerV1 := v1.NewHandler(h.services)
 	handlerV1.Init(e)
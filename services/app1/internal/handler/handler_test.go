@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		want    string
+	}{
+		{name: "no trusted proxy", remote: "10.0.0.1", want: "10.0.0.1"},
+		{name: "private network not trusted by default", proxies: []string{"192.0.2.0/24"}, remote: "10.0.0.1", want: "10.0.0.1"},
+		{name: "trusted proxy", proxies: []string{"10.0.0.0/8"}, remote: "10.0.0.1", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote + ":1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+			if got := ipExtractor(tt.proxies)(req); got != tt.want {
+				t.Errorf("client IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User is a row of the users table, created by migrations/0001_create_users.
+// Version locks its updates optimistically and DeletedAt makes its
+// deletion soft; see repository.Repository.
+type User struct {
+	ID        uint64         `json:"id" gorm:"primaryKey"`
+	Email     string         `json:"email"`
+	Name      string         `json:"name"`
+	Version   int64          `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `json:"-"`
+}
@@ -1,10 +1,21 @@
 package repository
 
-import "gorm.io/gorm"
+import (
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/outbox"
+
+	"gorm.io/gorm"
+)
 
 type Repositories struct {
+	Users *UsersRepo
+	// Outbox records the events to publish with the transaction of the
+	// changes they announce.
+	Outbox *outbox.Outbox
 }
 
 func NewRepositories(db *gorm.DB) *Repositories {
-	return &Repositories{}
+	return &Repositories{
+		Users:  NewUsersRepo(db),
+		Outbox: outbox.New(db),
+	}
 }
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/repository"
+	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type UsersRepo struct {
+	*repository.Repository[model.User]
+}
+
+func NewUsersRepo(db *gorm.DB) *UsersRepo {
+	return &UsersRepo{Repository: repository.New[model.User](db)}
+}
+
+// GetByEmail returns the user with email, or repository.ErrNotFound.
+func (r *UsersRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	var user model.User
+	err := r.DB(ctx).Where("email = ?", email).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CacheTTL is the time to live of the cached entries of the services. It
+// follows the cache.ttl config without a restart, so services read it
+// with Seconds when caching an entry rather than copying it.
+type CacheTTL struct {
+	seconds atomic.Int64
+}
+
+func NewCacheTTL(ttl time.Duration) *CacheTTL {
+	t := &CacheTTL{}
+	t.Set(ttl)
+
+	return t
+}
+
+// Seconds returns the current TTL in seconds.
+func (t *CacheTTL) Seconds() int64 {
+	return t.seconds.Load()
+}
+
+// Set changes the TTL, e.g. on config reload.
+func (t *CacheTTL) Set(ttl time.Duration) {
+	t.seconds.Store(int64(ttl.Seconds()))
+}
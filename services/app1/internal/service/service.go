@@ -2,6 +2,8 @@ package service
 
 import (
 	"github.com/rogpeppe/go-internal/cache"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/db"
+	"github.com/tuanp/go-mircroservice-boilerplate/pkg/lock"
 	"github.com/tuanp/go-mircroservice-boilerplate/pkg/logger"
 	"github.com/tuanp/go-mircroservice-boilerplate/services/app1/internal/repository"
 )
@@ -11,8 +13,10 @@ type Services struct {
 
 type Deps struct {
 	Repos       *repository.Repositories
+	Tx          *db.TxManager
+	Locker      lock.Locker
 	Cache       cache.Cache
-	CacheTTL    int64
+	CacheTTL    *CacheTTL
 	Environment string
 	Domain      string
 	Logger      logger.Logger
@@ -26,4 +30,4 @@ func NewServices(deps Deps) *Services {
 		//Schools:        schoolsService,
 
 	}
-}
\ No newline at end of file
+}
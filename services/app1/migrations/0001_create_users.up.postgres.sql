@@ -0,0 +1,8 @@
+CREATE TABLE users (
+    id         BIGSERIAL    PRIMARY KEY,
+    email      VARCHAR(255) NOT NULL,
+    name       VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ  NOT NULL,
+    updated_at TIMESTAMPTZ  NOT NULL,
+    CONSTRAINT users_email UNIQUE (email)
+);
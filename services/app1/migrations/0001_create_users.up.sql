@@ -0,0 +1,8 @@
+CREATE TABLE users (
+    id         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    email      VARCHAR(255)    NOT NULL,
+    name       VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at DATETIME(3)     NOT NULL,
+    updated_at DATETIME(3)     NOT NULL,
+    UNIQUE KEY users_email (email)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE users (
+    id         INTEGER      PRIMARY KEY AUTOINCREMENT,
+    email      VARCHAR(255) NOT NULL,
+    name       VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME     NOT NULL,
+    updated_at DATETIME     NOT NULL
+);
+
+CREATE UNIQUE INDEX users_email ON users (email);
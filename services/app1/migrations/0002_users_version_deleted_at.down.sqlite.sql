@@ -0,0 +1,3 @@
+DROP INDEX users_deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN version;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN version    BIGINT      NOT NULL DEFAULT 0,
+    ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+CREATE INDEX users_deleted_at ON users (deleted_at);
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN version    BIGINT      NOT NULL DEFAULT 0,
+    ADD COLUMN deleted_at DATETIME(3) NULL,
+    ADD INDEX users_deleted_at (deleted_at);
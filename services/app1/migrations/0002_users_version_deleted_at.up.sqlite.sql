@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN deleted_at DATETIME NULL;
+
+CREATE INDEX users_deleted_at ON users (deleted_at);
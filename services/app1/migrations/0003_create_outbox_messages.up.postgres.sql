@@ -0,0 +1,16 @@
+CREATE TABLE outbox_messages (
+    id              BIGSERIAL    PRIMARY KEY,
+    topic           VARCHAR(255) NOT NULL,
+    aggregate_type  VARCHAR(255) NOT NULL DEFAULT '',
+    aggregate_id    VARCHAR(255) NOT NULL DEFAULT '',
+    payload         BYTEA        NOT NULL,
+    headers         TEXT         NULL,
+    created_at      TIMESTAMPTZ  NOT NULL,
+    attempts        INT          NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ  NULL,
+    last_error      TEXT         NULL,
+    sent_at         TIMESTAMPTZ  NULL,
+    failed_at       TIMESTAMPTZ  NULL
+);
+
+CREATE INDEX outbox_messages_pending ON outbox_messages (id) WHERE sent_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE outbox_messages (
+    id              BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    topic           VARCHAR(255)    NOT NULL,
+    aggregate_type  VARCHAR(255)    NOT NULL DEFAULT '',
+    aggregate_id    VARCHAR(255)    NOT NULL DEFAULT '',
+    payload         MEDIUMBLOB      NOT NULL,
+    headers         TEXT            NULL,
+    created_at      DATETIME(3)     NOT NULL,
+    attempts        INT             NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(3)     NULL,
+    last_error      TEXT            NULL,
+    sent_at         DATETIME(3)     NULL,
+    failed_at       DATETIME(3)     NULL,
+    KEY outbox_messages_pending (sent_at, failed_at, id)
+);
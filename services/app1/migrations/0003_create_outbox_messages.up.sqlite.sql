@@ -0,0 +1,16 @@
+CREATE TABLE outbox_messages (
+    id              INTEGER      PRIMARY KEY AUTOINCREMENT,
+    topic           VARCHAR(255) NOT NULL,
+    aggregate_type  VARCHAR(255) NOT NULL DEFAULT '',
+    aggregate_id    VARCHAR(255) NOT NULL DEFAULT '',
+    payload         BLOB         NOT NULL,
+    headers         TEXT         NULL,
+    created_at      DATETIME     NOT NULL,
+    attempts        INT          NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME     NULL,
+    last_error      TEXT         NULL,
+    sent_at         DATETIME     NULL,
+    failed_at       DATETIME     NULL
+);
+
+CREATE INDEX outbox_messages_pending ON outbox_messages (sent_at, failed_at, id);
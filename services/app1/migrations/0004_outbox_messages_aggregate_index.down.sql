@@ -0,0 +1 @@
+DROP INDEX outbox_messages_aggregate ON outbox_messages;
@@ -0,0 +1 @@
+CREATE INDEX outbox_messages_aggregate ON outbox_messages (aggregate_type, aggregate_id, id);
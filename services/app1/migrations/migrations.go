@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations of app1, applied with
+// `app migrate`. See pkg/migrate for the file names.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS